@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package certtest generates CA, server and client certificates for
+// TLS tests.
+package certtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A Certs represents generated certificates. The CA, the ClientCert
+// and the ClientKey are paths of PEM files. The Pool contains the CA
+// and the Server is certificate of 127.0.0.1 signed by the CA.
+type Certs struct {
+	CA         string
+	ClientCert string
+	ClientKey  string
+	Pool       *x509.CertPool
+	Server     tls.Certificate
+}
+
+// Generate CA, server and client certificates and keys in the dir.
+// The clientCN is common name of the client certificate. The CA,
+// the client certificate and its key are written to the ca.crt,
+// client.crt and client.key files of the dir.
+func Generate(t testing.TB, dir, clientCN string) (c *Certs) {
+	t.Helper()
+
+	var write = func(name, typ string, der []byte) string {
+		var (
+			path = filepath.Join(dir, name)
+			data = pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+		)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var newKey = func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	var caKey = newKey()
+	var ca = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca,
+		&caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = x509.ParseCertificate(caDER); err != nil {
+		t.Fatal(err)
+	}
+
+	var issue = func(serial int64, cn string,
+		usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+
+		var key = newKey()
+		var tmpl = &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca,
+			&key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+
+	clientDER, clientKey := issue(2, clientCN, x509.ExtKeyUsageClientAuth)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverDER, serverKey := issue(3, "server", x509.ExtKeyUsageServerAuth)
+
+	c = &Certs{
+		CA:         write("ca.crt", "CERTIFICATE", caDER),
+		ClientCert: write("client.crt", "CERTIFICATE", clientDER),
+		ClientKey:  write("client.key", "EC PRIVATE KEY", keyDER),
+		Pool:       x509.NewCertPool(),
+		Server: tls.Certificate{
+			Certificate: [][]byte{serverDER},
+			PrivateKey:  serverKey,
+		},
+	}
+	c.Pool.AddCert(ca)
+	return
+}
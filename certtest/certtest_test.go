@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package certtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	// Generate(t testing.TB, dir, clientCN string) (c *Certs)
+
+	var c = Generate(t, t.TempDir(), "test_user")
+
+	data, err := os.ReadFile(c.ClientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no PEM block in client certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "test_user" {
+		t.Error("wrong common name:", cert.Subject.CommonName)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     c.Pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = tls.LoadX509KeyPair(c.ClientCert, c.ClientKey); err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Stat(c.CA); err != nil {
+		t.Error(err)
+	}
+	if len(c.Server.Certificate) != 1 || c.Server.PrivateKey == nil {
+		t.Error("wrong server certificate")
+	}
+
+}
@@ -0,0 +1,373 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package client is Go client of the storage service. It sends NATS
+// requests of the msg package and decodes responses, error codes of
+// responses are returned as errors, e.g. the ErrNotFound.
+//
+//	c := client.New(conn, msg.Name)
+//	ni, err := c.Get(ctx, id)
+//	if errors.Is(err, client.ErrNotFound) {
+//		// ...
+//	}
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/logrusorgru/news_micro_storage_system/logging"
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+	"github.com/logrusorgru/news_micro_storage_system/tracing"
+)
+
+// defaults
+const (
+	Timeout   = 10 * time.Second      // timeout of a request without deadline
+	Retries   = 2                     // retries of a failed request
+	RetryWait = 50 * time.Millisecond // pause between retries
+)
+
+// tracer of the client, it's looked up for every span, thus spans
+// go to current global tracer provider
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/logrusorgru/news_micro_storage_system/client")
+}
+
+// A Transport sends requests to storage services and returns their
+// responses. The *nats.Conn is NATS request-reply transport. Other
+// transports return the nats.ErrNoResponders if a storage service is
+// unavailable, and the nats.ErrTimeout or the ctx error if a request
+// timed out.
+type Transport interface {
+	RequestMsgWithContext(ctx context.Context, m *nats.Msg) (*nats.Msg, error)
+}
+
+// An Error is not OK code of a storage response. Use the errors.Is
+// with the Err* errors to check the code.
+type Error struct {
+	Code   msg.Code // response code
+	Detail string   // error message of the response
+}
+
+// errors of response codes
+var (
+	ErrNotFound          = &Error{Code: msg.Code_NOT_FOUND}
+	ErrInvalidArgument   = &Error{Code: msg.Code_INVALID_ARGUMENT}
+	ErrAlreadyExists     = &Error{Code: msg.Code_ALREADY_EXISTS}
+	ErrUnavailable       = &Error{Code: msg.Code_UNAVAILABLE}
+	ErrResourceExhausted = &Error{Code: msg.Code_RESOURCE_EXHAUSTED}
+	ErrDeadlineExceeded  = &Error{Code: msg.Code_DEADLINE_EXCEEDED}
+	ErrCanceled          = &Error{Code: msg.Code_CANCELED}
+	ErrInternal          = &Error{Code: msg.Code_INTERNAL}
+)
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	var code = strings.ToLower(strings.Replace(e.Code.String(), "_", " ", -1))
+	if e.Detail == "" {
+		return "storage: " + code
+	}
+	return "storage: " + code + ": " + e.Detail
+}
+
+// Is reports whether the target is an Error with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// codeError returns Error of given code, or nil if the code is OK.
+func codeError(code msg.Code, detail string) error {
+	if code == msg.Code_OK {
+		return nil
+	}
+	return &Error{Code: code, Detail: detail}
+}
+
+// A Client of storage services. Its fields should not be changed
+// while it's used. A Client is safe for concurrent use.
+type Client struct {
+	Transport Transport // the *nats.Conn or other transport
+	Subject   string    // base subject of the storage
+
+	// Timeout of a request if its context has no deadline,
+	// zero for no timeout
+	Timeout time.Duration
+	// Retries of a request that is not delivered, and of a read
+	// request that a storage service rejected being unavailable or
+	// overloaded. Retries stop on deadline of the request.
+	Retries   int
+	RetryWait time.Duration // pause between retries
+
+	// Observe is called after every NATS request, if set,
+	// e.g. to collect metrics
+	Observe func(subject string, start time.Time, err error)
+}
+
+// New client using given transport and subject with default timeout
+// and retries.
+func New(t Transport, subject string) (c *Client) {
+	c = new(Client)
+	c.Transport = t
+	c.Subject = subject
+	c.Timeout = Timeout
+	c.Retries = Retries
+	c.RetryWait = RetryWait
+	return
+}
+
+// Get news item by its identifier.
+func (c *Client) Get(ctx context.Context, id int64) (*msg.NewsItem, error) {
+	var rsp msg.Response
+	if err := c.request(ctx, c.Subject, &msg.ID{ID: id}, &rsp, true); err != nil {
+		return nil, err
+	}
+	return rsp.Item, nil
+}
+
+// Insert news item, it returns the item with identifier assigned.
+func (c *Client) Insert(
+	ctx context.Context,
+	ni *msg.NewsItem,
+) (
+	*msg.NewsItem,
+	error,
+) {
+	var rsp msg.Response
+	if err := c.request(ctx, c.Subject+msg.InsertSuffix,
+		&msg.InsertRequest{Item: ni}, &rsp, false); err != nil {
+		return nil, err
+	}
+	return rsp.Item, nil
+}
+
+// Update news item by its identifier.
+func (c *Client) Update(ctx context.Context, ni *msg.NewsItem) error {
+	var rsp msg.Response
+	return c.request(ctx, c.Subject+msg.UpdateSuffix,
+		&msg.UpdateRequest{Item: ni}, &rsp, false)
+}
+
+// Delete news item by its identifier.
+func (c *Client) Delete(ctx context.Context, id int64) error {
+	var rsp msg.Response
+	return c.request(ctx, c.Subject+msg.DeleteSuffix,
+		&msg.DeleteRequest{ID: id}, &rsp, false)
+}
+
+// List news items with identifiers greater than the after, ordered
+// by identifiers. The next is cursor of the next page, it's zero on
+// the last page.
+func (c *Client) List(
+	ctx context.Context,
+	after, limit int64,
+) (
+	items []*msg.NewsItem,
+	next int64,
+	err error,
+) {
+	var rsp msg.ListResponse
+	err = c.request(ctx, c.Subject+msg.ListSuffix,
+		&msg.ListRequest{After: after, Limit: limit}, &rsp, true)
+	if err != nil {
+		return
+	}
+	return rsp.Items, rsp.Next, nil
+}
+
+// Batch returns news items by given identifiers. The errs contains
+// identifiers of missing or failed items, use the ItemError to
+// convert them to errors.
+func (c *Client) Batch(
+	ctx context.Context,
+	ids []int64,
+) (
+	items []*msg.NewsItem,
+	errs []*msg.BatchError,
+	err error,
+) {
+	var rsp msg.BatchResponse
+	err = c.request(ctx, c.Subject+msg.BatchSuffix,
+		&msg.BatchRequest{IDs: ids}, &rsp, true)
+	if err != nil {
+		return
+	}
+	return rsp.Items, rsp.Errors, nil
+}
+
+// ItemError returns Error of an item of a batch.
+func ItemError(be *msg.BatchError) error {
+	return codeError(be.Code, be.Error)
+}
+
+// Health of the first storage service answered. It's never retried.
+func (c *Client) Health(ctx context.Context) (*msg.HealthResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var rsp msg.HealthResponse
+	if err := c.requestOnce(ctx, c.Subject+msg.HealthSuffix,
+		&msg.HealthRequest{}, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// withTimeout returns the ctx limited by the Timeout if the ctx
+// has no deadline
+func (c *Client) withTimeout(
+	ctx context.Context,
+) (
+	context.Context,
+	context.CancelFunc,
+) {
+	if _, ok := ctx.Deadline(); ok || c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// retry reports whether a request failed with the err can be retried,
+// the read is true for requests that don't change anything
+func retry(err error, read bool) bool {
+	if errors.Is(err, nats.ErrNoResponders) {
+		return true // not delivered
+	}
+	return read && (errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrResourceExhausted))
+}
+
+// request with retries, the rsp is msg.Response, msg.ListResponse
+// or msg.BatchResponse
+func (c *Client) request(
+	ctx context.Context,
+	subject string,
+	req proto.Message,
+	rsp proto.Message,
+	read bool,
+) (
+	err error,
+) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	for i := 0; ; i++ {
+		if err = c.requestOnce(ctx, subject, req, rsp); err == nil {
+			return
+		}
+		if i >= c.Retries || !retry(err, read) {
+			return
+		}
+		var timer = time.NewTimer(c.RetryWait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return // the last error
+		case <-timer.C:
+		}
+	}
+}
+
+// a coded is a response with code
+type coded interface {
+	GetCode() msg.Code
+	GetError() string
+}
+
+// requestOnce performs NATS request carrying trace context, request ID
+// and remaining time of the ctx in headers, and decodes response to the
+// rsp. It returns Error if the response has not OK code.
+func (c *Client) requestOnce(
+	ctx context.Context,
+	subject string,
+	req proto.Message,
+	rsp proto.Message,
+) (
+	err error,
+) {
+	val, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding request: %v", err)
+	}
+	var span trace.Span
+	ctx, span = tracer().Start(ctx, subject,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "nats"),
+			attribute.String("messaging.destination.name", subject),
+		),
+	)
+	var (
+		m     = &nats.Msg{Subject: subject, Data: val, Header: nats.Header{}}
+		start = time.Now()
+	)
+	if id := logging.RequestID(ctx); id != "" {
+		m.Header.Set(logging.RequestIDHeader, id)
+	}
+	setTimeout(ctx, m)
+	tracing.Inject(ctx, m)
+	resp, err := c.Transport.RequestMsgWithContext(ctx, m)
+	if c.Observe != nil {
+		c.Observe(subject, start, err)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return
+	}
+	if err = proto.Unmarshal(resp.Data, rsp); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+	if cr, ok := rsp.(coded); ok {
+		return codeError(cr.GetCode(), cr.GetError())
+	}
+	return
+}
+
+// setTimeout sets msg.TimeoutHeader of the NATS message to remaining
+// time of the ctx, if the ctx has deadline. Thus the storage doesn't
+// work on a request no one waits for.
+func setTimeout(ctx context.Context, m *nats.Msg) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	var ms = time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1 // expired, the storage skips it
+	}
+	if m.Header == nil {
+		m.Header = nats.Header{}
+	}
+	m.Header.Set(msg.TimeoutHeader, strconv.FormatInt(ms, 10))
+}
@@ -0,0 +1,364 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package client
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+	"github.com/logrusorgru/news_micro_storage_system/storage"
+)
+
+// transportFunc is a Transport of a function
+type transportFunc func(ctx context.Context, m *nats.Msg) (*nats.Msg, error)
+
+func (tf transportFunc) RequestMsgWithContext(
+	ctx context.Context,
+	m *nats.Msg,
+) (
+	*nats.Msg,
+	error,
+) {
+	return tf(ctx, m)
+}
+
+// respond with given response
+func respond(t *testing.T, rsp proto.Message) (*nats.Msg, error) {
+	t.Helper()
+	val, err := proto.Marshal(rsp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nats.Msg{Data: val}, nil
+}
+
+func TestError(t *testing.T) {
+	// Error() string
+	// Is(target error) bool
+
+	var err error = &Error{Code: msg.Code_NOT_FOUND, Detail: "no such item"}
+	if err.Error() != "storage: not found: no such item" {
+		t.Error("wrong error message:", err.Error())
+	}
+	if ErrNotFound.Error() != "storage: not found" {
+		t.Error("wrong error message:", ErrNotFound.Error())
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("not ErrNotFound")
+	}
+	if errors.Is(err, ErrInternal) || errors.Is(err, nats.ErrNoResponders) {
+		t.Error("unexpected match")
+	}
+	if codeError(msg.Code_OK, "") != nil {
+		t.Error("error of OK code")
+	}
+	if err := ItemError(&msg.BatchError{ID: 1,
+		Code: msg.Code_UNAVAILABLE}); !errors.Is(err, ErrUnavailable) {
+		t.Error("wrong item error:", err)
+	}
+
+}
+
+func TestNew(t *testing.T) {
+	// New(t Transport, subject string) (c *Client)
+
+	var c = New(nil, "subject")
+	if c.Subject != "subject" || c.Timeout != Timeout ||
+		c.Retries != Retries || c.RetryWait != RetryWait {
+		t.Errorf("wrong client: %+v", c)
+	}
+
+}
+
+func TestClient(t *testing.T) {
+	// Get(ctx context.Context, id int64) (*msg.NewsItem, error)
+	// Insert(ctx context.Context, ni *msg.NewsItem) (*msg.NewsItem, error)
+	// Update(ctx context.Context, ni *msg.NewsItem) error
+	// Delete(ctx context.Context, id int64) error
+	// List(ctx context.Context, after, limit int64) (items []*msg.NewsItem,
+	//     next int64, err error)
+	// Batch(ctx context.Context, ids []int64) (items []*msg.NewsItem,
+	//     errs []*msg.BatchError, err error)
+	// Health(ctx context.Context) (*msg.HealthResponse, error)
+
+	var (
+		sctx  = storage.NewContext()
+		conf  = storage.NewConfig()
+		store = storage.NewMemStore()
+	)
+	defer sctx.Cancel()
+	var qq = storage.NewDirect(sctx, conf, store)
+	defer qq.Close()
+
+	var (
+		c   = New(qq, conf.Subject)
+		ctx = context.Background()
+	)
+
+	one, err := c.Insert(ctx, &msg.NewsItem{Header: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	two, err := c.Insert(ctx, &msg.NewsItem{Header: "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.ID == 0 || two.ID == 0 || one.ID == two.ID {
+		t.Fatal("wrong identifiers:", one.ID, two.ID)
+	}
+
+	ni, err := c.Get(ctx, one.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ni.ID != one.ID || ni.Header != "one" {
+		t.Error("wrong item:", ni.String())
+	}
+
+	one.Header = "one-updated"
+	if err = c.Update(ctx, one); err != nil {
+		t.Fatal(err)
+	}
+	if ni, err = c.Get(ctx, one.ID); err != nil {
+		t.Fatal(err)
+	} else if ni.Header != "one-updated" {
+		t.Error("not updated:", ni.String())
+	}
+
+	items, next, err := c.List(ctx, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != one.ID || next != one.ID {
+		t.Error("wrong first page:", items, next)
+	}
+	if items, next, err = c.List(ctx, next, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != two.ID || next != 0 {
+		t.Error("wrong last page:", items, next)
+	}
+
+	var missing = two.ID + 100
+	items, errs, err := c.Batch(ctx, []int64{one.ID, missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != one.ID {
+		t.Error("wrong batch items:", items)
+	}
+	if len(errs) != 1 || errs[0].ID != missing ||
+		!errors.Is(ItemError(errs[0]), ErrNotFound) {
+		t.Error("wrong batch errors:", errs)
+	}
+
+	if err = c.Delete(ctx, two.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Get(ctx, two.ID); !errors.Is(err, ErrNotFound) {
+		t.Error("unexpected error:", err)
+	}
+	if err = c.Delete(ctx, two.ID); !errors.Is(err, ErrNotFound) {
+		t.Error("unexpected error:", err)
+	}
+	if err = c.Update(ctx, two); !errors.Is(err, ErrNotFound) {
+		t.Error("unexpected error:", err)
+	}
+
+	hr, err := c.Health(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hr.DB != "ok" || hr.Instance == "" {
+		t.Errorf("wrong health: %v", hr)
+	}
+
+}
+
+func TestClient_retries(t *testing.T) {
+
+	var (
+		calls int
+		fail  []error // of the calls
+		c     = New(transportFunc(func(
+			ctx context.Context,
+			m *nats.Msg,
+		) (
+			*nats.Msg,
+			error,
+		) {
+			calls++
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("no deadline")
+			}
+			if len(fail) > 0 {
+				var err = fail[0]
+				fail = fail[1:]
+				if ce, ok := err.(*Error); ok {
+					return respond(t, &msg.Response{Code: ce.Code})
+				}
+				return nil, err
+			}
+			return respond(t, &msg.Response{Item: &msg.NewsItem{ID: 1}})
+		}), "test")
+		ctx = context.Background()
+	)
+	c.RetryWait = time.Millisecond
+
+	var get = func(errs ...error) (err error) {
+		calls, fail = 0, errs
+		_, err = c.Get(ctx, 1)
+		return
+	}
+	var insert = func(errs ...error) (err error) {
+		calls, fail = 0, errs
+		_, err = c.Insert(ctx, &msg.NewsItem{})
+		return
+	}
+
+	// retried
+	if err := get(nats.ErrNoResponders, ErrUnavailable); err != nil ||
+		calls != 3 {
+		t.Error("unexpected result:", err, calls)
+	}
+	if err := insert(nats.ErrNoResponders); err != nil || calls != 2 {
+		t.Error("unexpected result:", err, calls)
+	}
+
+	// too many failures
+	if err := get(ErrResourceExhausted, ErrResourceExhausted,
+		ErrResourceExhausted); !errors.Is(err, ErrResourceExhausted) ||
+		calls != 3 {
+		t.Error("unexpected result:", err, calls)
+	}
+
+	// not retried
+	if err := insert(ErrUnavailable); !errors.Is(err, ErrUnavailable) ||
+		calls != 1 {
+		t.Error("unexpected result:", err, calls)
+	}
+	if err := get(ErrNotFound); !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Error("unexpected result:", err, calls)
+	}
+	if err := get(nats.ErrTimeout); !errors.Is(err, nats.ErrTimeout) ||
+		calls != 1 {
+		t.Error("unexpected result:", err, calls)
+	}
+
+	// no retries
+	c.Retries = 0
+	if err := get(nats.ErrNoResponders); !errors.Is(err,
+		nats.ErrNoResponders) || calls != 1 {
+		t.Error("unexpected result:", err, calls)
+	}
+
+	// retries stop on deadline
+	c.Retries, c.RetryWait = 100, time.Hour
+	var tctx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	calls, fail = 0, []error{nats.ErrNoResponders, nats.ErrNoResponders}
+	if _, err := c.Get(tctx, 1); !errors.Is(err, nats.ErrNoResponders) ||
+		calls != 1 {
+		t.Error("unexpected result:", err, calls)
+	}
+
+}
+
+func TestClient_requestOnce(t *testing.T) {
+	// requestOnce(ctx context.Context, subject string, req proto.Message,
+	//     rsp proto.Message) (err error)
+
+	var (
+		header nats.Header
+		data   = []byte{0xff} // malformed
+		c      = New(transportFunc(func(
+			ctx context.Context,
+			m *nats.Msg,
+		) (
+			*nats.Msg,
+			error,
+		) {
+			header = m.Header
+			return &nats.Msg{Data: data}, nil
+		}), "test")
+		observed string
+	)
+	c.Observe = func(subject string, start time.Time, err error) {
+		observed = subject
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var rsp msg.Response
+	if err := c.requestOnce(ctx, "test", &msg.ID{ID: 1}, &rsp); err == nil {
+		t.Error("missing decoding error")
+	}
+	if observed != "test" {
+		t.Error("not observed")
+	}
+	ms, err := strconv.ParseInt(header.Get(msg.TimeoutHeader), 10, 64)
+	if err != nil || ms <= 0 || ms > 1000 {
+		t.Error("wrong timeout header:", header.Get(msg.TimeoutHeader))
+	}
+
+}
+
+func Test_setTimeout(t *testing.T) {
+	// setTimeout(ctx context.Context, m *nats.Msg)
+
+	var m = new(nats.Msg)
+	setTimeout(context.Background(), m)
+	if m.Header.Get(msg.TimeoutHeader) != "" {
+		t.Error("unexpected timeout header")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	setTimeout(ctx, m)
+	ms, err := strconv.ParseInt(m.Header.Get(msg.TimeoutHeader), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms <= 900 || ms > 1000 {
+		t.Error("wrong timeout:", ms)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(),
+		time.Now().Add(-time.Second))
+	defer cancel()
+	setTimeout(ctx, m)
+	if val := m.Header.Get(msg.TimeoutHeader); val != "1" {
+		t.Error("wrong timeout of expired context:", val)
+	}
+
+}
@@ -0,0 +1,279 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// The newsd is the query client and the storage in one process.
+// The query client uses the storage directly, or through NATS
+// depending on the -transport flag. Flags of the storage have
+// the "storage-" prefix, logging, tracing and metrics are configured
+// by the query client flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/logrusorgru/news_micro_storage_system/config"
+	"github.com/logrusorgru/news_micro_storage_system/queryClient"
+	"github.com/logrusorgru/news_micro_storage_system/storage"
+)
+
+// EnvPrefix of environment variables of the newsd.
+const EnvPrefix = "NEWSD_"
+
+// prefix of flags of the storage
+const storagePrefix = "storage-"
+
+// unused flags of the storage, without the prefix, the query client
+// configures logging, tracing and metrics of the newsd
+var unusedStorageFlags = map[string]bool{
+	"log-level":           true,
+	"trace-exporter":      true,
+	"trace-otlp-endpoint": true,
+	"trace-sample-ratio":  true,
+	"metrics-listen":      true,
+}
+
+// storageFlags registers flags of the storage in the fset, except
+// the unused ones, usage of the password flag refers to the NEWSD_
+// environment variable
+func storageFlags(fset *flag.FlagSet, sc *storage.Config) {
+	var all = flag.NewFlagSet(storagePrefix, flag.ContinueOnError)
+	sc.FromFlags(all, storagePrefix)
+	all.VisitAll(func(f *flag.Flag) {
+		var name = strings.TrimPrefix(f.Name, storagePrefix)
+		if unusedStorageFlags[name] {
+			return
+		}
+		var usage = f.Usage
+		if name == "db-password" {
+			// the storage usage names its own flags and variables
+			usage = "database password, insecure, use -" + storagePrefix +
+				"db-password-file or " + config.EnvName(EnvPrefix, f.Name) +
+				" environment variable instead"
+		}
+		fset.Var(f.Value, f.Name, usage)
+	})
+}
+
+// transports
+const (
+	transportDirect = "direct" // in-process, without NATS
+	transportNATS   = "nats"   // NATS request-reply
+)
+
+// validate configurations
+func validate(
+	transport string,
+	qc *queryClient.Config,
+	sc *storage.Config,
+) (
+	err error,
+) {
+	if err = qc.Validate(); err != nil {
+		return
+	}
+	if err = sc.Validate(); err != nil {
+		return fmt.Errorf("storage: %v", err)
+	}
+	switch transport {
+	case transportDirect:
+		if sc.NATSEmbedded != "" {
+			return errors.New("embedded NATS server requires nats transport")
+		}
+		var def = storage.NewConfig()
+		if sc.NATSURL != def.NATSURL || sc.Queue != def.Queue ||
+			sc.NATS != def.NATS || sc.PendingMsgs != def.PendingMsgs ||
+			sc.PendingBytes != def.PendingBytes {
+			return errors.New("storage NATS options require nats transport")
+		}
+	case transportNATS:
+		if sc.NATSEmbedded == "" && qc.NATSURL != sc.NATSURL {
+			return fmt.Errorf("NATS url %q and storage NATS url %q "+
+				"mismatch", qc.NATSURL, sc.NATSURL)
+		}
+	default:
+		return fmt.Errorf("unknown transport %q, expected %s or %s",
+			transport, transportDirect, transportNATS)
+	}
+	if qc.Subject != sc.Subject {
+		return fmt.Errorf("NATS subject %q and storage NATS subject %q "+
+			"mismatch", qc.Subject, sc.Subject)
+	}
+	return
+}
+
+// fatal logs the error and exits with non-zero code
+func fatal(err error) {
+	slog.Error("fatal error", "error", err)
+	os.Exit(1)
+}
+
+func main() {
+
+	var (
+		qconf     = queryClient.NewConfig()
+		sconf     = storage.NewConfig()
+		transport string
+	)
+	qconf.FromFlags(flag.CommandLine, "")
+	storageFlags(flag.CommandLine, sconf)
+	flag.StringVar(&transport, "transport", transportDirect,
+		"transport to the storage: direct (in-process) or nats")
+	print, err := config.Parse(flag.CommandLine, os.Args[1:], EnvPrefix)
+	if err != nil {
+		fatal(err)
+	}
+
+	slog.SetDefault(qconf.Log.New(os.Stdout, "newsd"))
+
+	if print {
+		if err := config.Print(os.Stdout, flag.CommandLine); err != nil {
+			fatal(err)
+		}
+	}
+	if err := validate(transport, qconf, sconf); err != nil {
+		fatal(err)
+	}
+	if print {
+		return
+	}
+
+	flushTraces, err := qconf.Trace.Setup("newsd")
+	if err != nil {
+		fatal(err)
+	}
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	ctx := storage.NewContext()
+
+	defer func() {
+		if err := ctx.Errs(); err != nil {
+			fatal(err) // for the exit code
+		}
+	}()
+	defer func() {
+		// after the storage closed, thus all spans ended
+		fctx, cancel := context.WithTimeout(context.Background(),
+			qconf.ShutdownTimeout)
+		defer cancel()
+		if err := flushTraces(fctx); err != nil {
+			slog.Error("flushing traces", "error", err)
+		}
+	}()
+
+	if sconf.NATSEmbedded != "" {
+		ns, err := storage.StartNATS(ctx, sconf.NATSEmbedded)
+		if err != nil {
+			ctx.Terminate(err)
+			return
+		}
+		defer ns.WaitForShutdown() // after the ctx canceled
+		sconf.NATSURL, qconf.NATSURL = ns.ClientURL(), ns.ClientURL()
+	}
+	defer ctx.Cancel() // after the storage closed, shuts down NATS
+
+	store, cs, signaled, err := storage.OpenStore(sconf, sigs)
+	if signaled {
+		return
+	}
+	if err != nil {
+		ctx.Terminate(err)
+		return
+	}
+	defer store.Close() // after the QQ closed
+
+	var (
+		qq  *storage.QQ
+		srv *queryClient.Server
+	)
+	if transport == transportDirect {
+		qq = storage.NewDirect(ctx, sconf, store)
+		srv = queryClient.NewServerTransport(qconf, qq)
+	} else {
+		if qq, err = storage.NewQQ(ctx, sconf, store); err != nil {
+			ctx.Terminate(err)
+			return
+		}
+		if srv, err = queryClient.NewServer(qconf); err != nil {
+			qq.Close()
+			ctx.Terminate(err)
+			return
+		}
+	}
+	defer func() {
+		// after the srv shut down, finishing accepted requests
+		if err := qq.Close(); err != nil {
+			slog.Error("closing storage", "error", err)
+		}
+	}()
+	if err := srv.Register(append(cs, qq.Collectors()...)...); err != nil {
+		srv.Close()
+		ctx.Terminate(err)
+		return
+	}
+
+	var errc = make(chan error, 1)
+	go func() {
+		errc <- srv.Server.ListenAndServe()
+	}()
+	if srv.Metrics.Addr != "" {
+		go func() {
+			err := srv.Metrics.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				slog.Error("serving metrics", "error", err)
+			}
+		}()
+	}
+	slog.Info("newsd started", "addr", qconf.Addr, "transport", transport)
+
+	select {
+	case sig := <-sigs:
+		slog.Info("got signal, exiting...", "signal", sig.String())
+	case <-ctx.Ctx.Done():
+		slog.Info("terminated, exiting...")
+	case err := <-errc:
+		srv.Close()
+		ctx.Terminate(err)
+		return
+	}
+
+	if err := srv.Shutdown(); err != nil {
+		ctx.Terminate(err)
+	}
+	if err := <-errc; err != http.ErrServerClosed {
+		ctx.Terminate(err)
+	}
+}
@@ -26,28 +26,94 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/logrusorgru/news_micro_storage_system/config"
 	"github.com/logrusorgru/news_micro_storage_system/queryClient"
 )
 
-func main() {
+// fatal logs the error and exits with non-zero code
+func fatal(err error) {
+	slog.Error("fatal error", "error", err)
+	os.Exit(1)
+}
 
-	log.SetOutput(os.Stdout)
+func main() {
 
 	conf := queryClient.NewConfig()
 	conf.FromFlags(flag.CommandLine, "")
-	flag.Parse()
+	print, err := config.Parse(flag.CommandLine, os.Args[1:], queryClient.EnvPrefix)
+	if err != nil {
+		fatal(err)
+	}
+
+	slog.SetDefault(conf.Log.New(os.Stdout, "query_client"))
+
+	if print {
+		if err := config.Print(os.Stdout, flag.CommandLine); err != nil {
+			fatal(err)
+		}
+	}
+	if err := conf.Validate(); err != nil {
+		fatal(err)
+	}
+	if print {
+		return
+	}
+
+	flushTraces, err := conf.Trace.Setup("query_client")
+	if err != nil {
+		fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			conf.ShutdownTimeout)
+		defer cancel()
+		if err := flushTraces(ctx); err != nil {
+			slog.Error("flushing traces", "error", err)
+		}
+	}()
 
 	srv, err := queryClient.NewServer(conf)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
-	defer srv.Close()
 
-	if err := srv.Server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	var errc = make(chan error, 1)
+	go func() {
+		errc <- srv.Server.ListenAndServe()
+	}()
+	if srv.Metrics.Addr != "" {
+		go func() {
+			err := srv.Metrics.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				slog.Error("serving metrics", "error", err)
+			}
+		}()
+	}
+
+	select {
+	case sig := <-sigs:
+		slog.Info("got signal, exiting...", "signal", sig.String())
+	case err := <-errc:
+		srv.Close()
+		fatal(err)
+	}
+	signal.Stop(sigs)
+
+	if err := srv.Shutdown(); err != nil {
+		fatal(err)
+	}
+	if err := <-errc; err != http.ErrServerClosed {
+		fatal(err)
 	}
 }
@@ -26,55 +26,147 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/logrusorgru/news_micro_storage_system/config"
 	"github.com/logrusorgru/news_micro_storage_system/storage"
 )
 
-func waitSigInt(ctx *storage.Context) {
+// waitSignal waits for SIGINT or SIGTERM, or for the ctx terminated
+// by an error.
+func waitSignal(ctx *storage.Context, sigs <-chan os.Signal) {
+	select {
+	case sig := <-sigs:
+		slog.Info("got signal, exiting...", "signal", sig.String())
+	case <-ctx.Ctx.Done():
+		slog.Info("terminated, exiting...")
+	}
+}
 
-	sigs := make(chan os.Signal, 2)
-	signal.Notify(sigs, os.Interrupt)
+// serveMetrics starts metrics HTTP server
+func serveMetrics(addr string, cs []prometheus.Collector) *http.Server {
+	var mux = http.NewServeMux()
+	mux.Handle("/metrics", storage.MetricsHandler(cs...))
+	var srv = &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			slog.Error("serving metrics", "error", err)
+		}
+	}()
+	return srv
+}
 
-	log.Printf("got signal %s, exiting...", <-sigs)
-	ctx.Cancel()
+// fatal logs the error and exits with non-zero code
+func fatal(err error) {
+	slog.Error("fatal error", "error", err)
+	os.Exit(1)
 }
 
 func main() {
 
-	log.SetOutput(os.Stdout)
-
 	conf := storage.NewConfig()
 	conf.FromFlags(flag.CommandLine, "")
-	flag.Parse()
+	print, err := config.Parse(flag.CommandLine, os.Args[1:], storage.EnvPrefix)
+	if err != nil {
+		fatal(err)
+	}
+
+	slog.SetDefault(conf.Log.New(os.Stdout, "storage"))
+
+	if print {
+		if err := config.Print(os.Stdout, flag.CommandLine); err != nil {
+			fatal(err)
+		}
+	}
+	if err := conf.Validate(); err != nil {
+		fatal(err)
+	}
+	if print {
+		return
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(conf, flag.Args()[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	flushTraces, err := conf.Trace.Setup("storage")
+	if err != nil {
+		fatal(err)
+	}
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
 
 	ctx := storage.NewContext()
 
 	defer func() {
 		if err := ctx.Errs(); err != nil {
-			log.Fatal(err) // for the exit code
+			fatal(err) // for the exit code
+		}
+	}()
+	defer func() {
+		// after the QQ closed, thus all spans ended
+		fctx, cancel := context.WithTimeout(context.Background(),
+			conf.DrainTimeout)
+		defer cancel()
+		if err := flushTraces(fctx); err != nil {
+			slog.Error("flushing traces", "error", err)
 		}
 	}()
 
-	db, err := storage.NewDB(conf)
-	if err != nil {
-		log.Fatal(err)
+	if conf.NATSEmbedded != "" {
+		ns, err := storage.StartNATS(ctx, conf.NATSEmbedded)
+		if err != nil {
+			ctx.Terminate(err)
+			return
+		}
+		defer ns.WaitForShutdown() // after the ctx canceled
+		conf.NATSURL = ns.ClientURL()
 	}
-	defer db.Close()
+	defer ctx.Cancel() // after the QQ and the DB closed, shuts down NATS
 
-	if err := db.Init(ctx); err != nil {
+	store, cs, signaled, err := storage.OpenStore(conf, sigs)
+	if signaled {
+		return
+	}
+	if err != nil {
 		ctx.Terminate(err)
 		return
 	}
+	defer store.Close() // after the QQ closed
 
-	qq, err := storage.NewQQ(ctx, conf, db)
+	qq, err := storage.NewQQ(ctx, conf, store)
 	if err != nil {
-		log.Fatal(err)
+		ctx.Terminate(err)
+		return
+	}
+	defer func() {
+		// drain, finishing accepted requests
+		if err := qq.Close(); err != nil {
+			slog.Error("closing NATS", "error", err)
+		}
+	}()
+
+	if conf.MetricsListen != "" {
+		var ms = serveMetrics(conf.MetricsListen,
+			append(cs, qq.Collectors()...))
+		defer ms.Close()
 	}
-	defer qq.Close()
 
-	waitSigInt(ctx)
+	// NATS and DB outages don't stop the service, it keeps working
+	// in degraded mode until a signal, or until the ctx terminated
+	// if all NATS reconnect attempts failed
+	waitSignal(ctx, sigs)
 }
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/logrusorgru/news_micro_storage_system/migrations"
+	"github.com/logrusorgru/news_micro_storage_system/storage"
+)
+
+const migrateUsage = `usage: storage [flags] migrate [-yes] [command]
+
+commands:
+  up        migrate to the latest version (default)
+  down      migrate one version down
+  to N      migrate to version N
+  version   print current and latest versions
+
+flags:
+  -yes      confirm migration to version 0, it drops all news items`
+
+// migrate executes the migrate subcommand.
+func migrate(conf *storage.Config, args []string) (err error) {
+
+	if conf.Backend != storage.BackendCockroachDB {
+		return fmt.Errorf("%s storage backend has no schema", conf.Backend)
+	}
+
+	var fset = flag.NewFlagSet("migrate", flag.ContinueOnError)
+	var yes = fset.Bool("yes", false,
+		"confirm migration to version 0, it drops all news items")
+	if err = fset.Parse(args); err != nil {
+		return fmt.Errorf("%w\n%s", err, migrateUsage)
+	}
+	args = fset.Args()
+
+	var (
+		command = "up"
+		target  int
+	)
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "up", "down", "version":
+	case "to":
+		if len(args) != 1 {
+			return fmt.Errorf("missing version\n%s", migrateUsage)
+		}
+		if target, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("invalid version: %w", err)
+		}
+		args = args[1:]
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, migrateUsage)
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %q\n%s", args, migrateUsage)
+	}
+
+	var db *storage.DB
+	if db, err = storage.NewDB(conf); err != nil {
+		return
+	}
+	defer db.Close()
+
+	var m *migrations.Migrator
+	if m, err = migrations.New(db.DB); err != nil {
+		return
+	}
+
+	var (
+		ctx     = context.Background()
+		version int
+	)
+	if version, err = m.Version(ctx); err != nil {
+		return
+	}
+	if command == "down" {
+		target = version - 1
+	}
+	if (command == "down" || command == "to") && target == 0 &&
+		version > 0 && !*yes {
+		return fmt.Errorf("migration to version 0 drops all news items, " +
+			"use -yes to confirm")
+	}
+
+	switch command {
+	case "up":
+		err = m.Up(ctx)
+	case "down":
+		err = m.Down(ctx)
+	case "to":
+		err = m.Migrate(ctx, target)
+	}
+	if err != nil {
+		return
+	}
+
+	if version, err = m.Version(ctx); err != nil {
+		return
+	}
+	slog.Info("schema version", "version", version, "latest", m.Latest())
+	return
+}
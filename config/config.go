@@ -0,0 +1,266 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package config loads settings of a service, registered as
+// command-line flags, from environment variables and from a YAML or
+// TOML config file. The precedence is
+//
+//	defaults < config file < environment variables < command line
+//
+// Keys of a config file are names of the flags, nested keys are joined
+// by "-", thus
+//
+//	db:
+//	  addr: localhost
+//	  port: 26257
+//
+// is the same as "db-addr: localhost" and "db-port: 26257". A name of
+// an environment variable is the flag name in upper case with "_"
+// instead of "-" and with a prefix, e.g. NEWS_STORAGE_DB_ADDR.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// flags of the package
+const (
+	FileFlag  = "config"       // config file path
+	PrintFlag = "print-config" // print effective config and exit
+)
+
+// Redacted replaces values of secrets printed.
+const Redacted = "<redacted>"
+
+// EnvName returns name of environment variable of a flag.
+func EnvName(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// Secret reports whether the flag is a secret that is not printed,
+// e.g. a password or a token. A file of a secret is not a secret.
+func Secret(name string) bool {
+	return strings.HasSuffix(name, "password") ||
+		strings.HasSuffix(name, "token")
+}
+
+// RedactURL replaces user info of the val by the Redacted, if the val
+// is URL or comma-separated list of URLs with user info, e.g. NATS
+// servers. Other values are returned as is.
+func RedactURL(val string) string {
+	var parts = strings.Split(val, ",")
+	for i, part := range parts {
+		var u, err = url.Parse(strings.TrimSpace(part))
+		if err != nil || u.User == nil || u.Scheme == "" {
+			continue
+		}
+		u.User = nil
+		parts[i] = u.Scheme + "://" + Redacted + "@" +
+			strings.TrimPrefix(u.String(), u.Scheme+"://")
+	}
+	return strings.Join(parts, ",")
+}
+
+// Parse registers -config and -print-config flags and parses the args
+// by the fset. Then it sets flags not given in the args from
+// environment variables with the envPrefix and from the config file,
+// if any. It returns true if the -print-config flag is set.
+func Parse(fset *flag.FlagSet, args []string, envPrefix string) (
+	print bool,
+	err error,
+) {
+
+	var file = fset.String(FileFlag, "",
+		"YAML (.yaml, .yml) or TOML (.toml) config file")
+	fset.BoolVar(&print, PrintFlag, false,
+		"print effective config with secrets redacted and exit")
+	if err = fset.Parse(args); err != nil {
+		return
+	}
+
+	// given in the args
+	var set = make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// environment overrides the file, thus the file can be
+	// set by environment variable too
+	fset.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		var name = EnvName(envPrefix, f.Name)
+		if val, ok := os.LookupEnv(name); ok {
+			if serr := fset.Set(f.Name, val); serr != nil {
+				err = fmt.Errorf("environment variable %s: %v", name, serr)
+			}
+			set[f.Name] = true
+		}
+	})
+	if err != nil || *file == "" {
+		return
+	}
+
+	var values map[string]string
+	if values, err = ReadFile(*file); err != nil {
+		return
+	}
+	var names = make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == FileFlag || name == PrintFlag || fset.Lookup(name) == nil {
+			return print, fmt.Errorf("%s: unknown key %q", *file, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err = fset.Set(name, values[name]); err != nil {
+			return print, fmt.Errorf("%s: %s: %v", *file, name, err)
+		}
+	}
+	return
+}
+
+// ReadFile reads YAML or TOML config file, by its extension, and
+// returns its values by flag names.
+func ReadFile(path string) (values map[string]string, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	var tree = make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: unknown config file format %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	values = make(map[string]string)
+	if err = flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return
+}
+
+// flatten nested keys of the tree joining them by "-"
+func flatten(
+	prefix string,
+	tree map[string]interface{},
+	values map[string]string,
+) (
+	err error,
+) {
+	for key, val := range tree {
+		var name = prefix + key
+		switch v := val.(type) {
+		case map[string]interface{}:
+			if err = flatten(name+"-", v, values); err != nil {
+				return
+			}
+		case []interface{}, nil:
+			return fmt.Errorf("%s: expected a value, got %v", name, val)
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return
+}
+
+// Print writes effective values of all flags of the fset as YAML
+// config file. Values of secrets and user info of URLs are redacted.
+func Print(w io.Writer, fset *flag.FlagSet) (err error) {
+	var values = make(map[string]string)
+	fset.VisitAll(func(f *flag.Flag) {
+		if f.Name == FileFlag || f.Name == PrintFlag {
+			return
+		}
+		var val = f.Value.String()
+		if val != "" && Secret(f.Name) {
+			val = Redacted
+		} else {
+			val = RedactURL(val)
+		}
+		values[f.Name] = val
+	})
+	var enc = yaml.NewEncoder(w)
+	if err = enc.Encode(values); err != nil {
+		return
+	}
+	return enc.Close()
+}
+
+// ValidPort reports whether the port is a valid TCP port.
+func ValidPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// ValidAddr reports whether the addr is a valid host:port listen
+// address, the host may be empty, the port may be 0 (any free port).
+func ValidAddr(addr string) bool {
+	var _, port, err = net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	var p int
+	if p, err = strconv.Atoi(port); err != nil {
+		return false
+	}
+	return p == 0 || ValidPort(p)
+}
+
+// ValidSubject reports whether the subject is a valid NATS subject to
+// publish or subscribe to without wildcards.
+func ValidSubject(subject string) bool {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return false
+	}
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" {
+			return false
+		}
+	}
+	return true
+}
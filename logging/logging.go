@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package logging represents structured logging settings shared by
+// the storage and the queryClient, and request IDs that correlate log
+// records of one request across the services.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log/slog"
+)
+
+// RequestIDHeader is HTTP and NATS header of a request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// defaults
+const (
+	Level = slog.LevelInfo
+)
+
+// A Config represents logging settings.
+type Config struct {
+	Level slog.Level // min level of records
+}
+
+// NewConfig with defaults.
+func NewConfig() (c *Config) {
+	c = new(Config)
+	c.Level = Level
+	return
+}
+
+// FromFlags obtains config values from command-line flags.
+// The prefix argument used to prefix all the flags with the
+// given prefix.
+func (c *Config) FromFlags(fset *flag.FlagSet, prefix string) {
+	fset.TextVar(&c.Level,
+		prefix+"log-level",
+		c.Level,
+		"log level: debug, info, warn or error")
+}
+
+// New JSON logger of given service writing to the w. Use
+//
+//	slog.SetDefault(conf.Log.New(os.Stdout, "storage"))
+//
+// to make it default, the log package writes to it too.
+func (c *Config) New(w io.Writer, service string) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: c.Level,
+	})).With("service", service)
+}
+
+// NewRequestID returns new random request ID.
+func NewRequestID() string {
+	var id [16]byte
+	rand.Read(id[:]) // never returns an error
+	return hex.EncodeToString(id[:])
+}
+
+// context key of a request ID
+type requestIDKey struct{}
+
+// WithRequestID returns copy of the ctx with given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID of the ctx or empty string.
+func RequestID(ctx context.Context) string {
+	var id, _ = ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logger returns default logger with request ID of the ctx, if any.
+func Logger(ctx context.Context) *slog.Logger {
+	return With(RequestID(ctx))
+}
+
+// With returns default logger with given request ID, if not empty.
+func With(id string) *slog.Logger {
+	if id == "" {
+		return slog.Default()
+	}
+	return slog.Default().With("request_id", id)
+}
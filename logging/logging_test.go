@@ -0,0 +1,153 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"testing"
+)
+
+func TestNewConfig(t *testing.T) {
+	// NewConfig() (c *Config)
+
+	if conf := NewConfig(); conf.Level != Level {
+		t.Error("NewConfig contains non-default values")
+	}
+
+}
+
+func TestConfig_FromFlags(t *testing.T) {
+	// FromFlags(fset *flag.FlagSet, prefix string)
+
+	var fset = flag.NewFlagSet("test-set", flag.ContinueOnError)
+	var conf = NewConfig()
+
+	conf.FromFlags(fset, "x-")
+	if err := fset.Parse([]string{"-x-log-level", "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Level != slog.LevelDebug {
+		t.Error("incorrect arguments parsing:", conf.Level)
+	}
+
+	fset = flag.NewFlagSet("test-set", flag.ContinueOnError)
+	fset.SetOutput(new(bytes.Buffer))
+	conf.FromFlags(fset, "")
+	if err := fset.Parse([]string{"-log-level", "verbose"}); err == nil {
+		t.Error("missing error")
+	}
+
+}
+
+// records decodes JSON log records
+func records(t *testing.T, buf *bytes.Buffer) (rs []map[string]interface{}) {
+	var dec = json.NewDecoder(buf)
+	for dec.More() {
+		var r map[string]interface{}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	return
+}
+
+func TestConfig_New(t *testing.T) {
+	// New(w io.Writer, service string) *slog.Logger
+
+	var (
+		buf  bytes.Buffer
+		conf = Config{Level: slog.LevelWarn}
+		l    = conf.New(&buf, "test")
+	)
+	l.Info("skipped")
+	l.Warn("logged", "key", "value")
+
+	var rs = records(t, &buf)
+	if len(rs) != 1 {
+		t.Fatal("wrong number of records:", len(rs))
+	}
+	if rs[0]["msg"] != "logged" || rs[0]["level"] != "WARN" ||
+		rs[0]["service"] != "test" || rs[0]["key"] != "value" {
+		t.Error("wrong record:", rs[0])
+	}
+
+}
+
+func TestNewRequestID(t *testing.T) {
+	// NewRequestID() string
+
+	var a, b = NewRequestID(), NewRequestID()
+	if len(a) != 32 || len(b) != 32 {
+		t.Error("wrong length:", a, b)
+	}
+	if a == b {
+		t.Error("not unique:", a)
+	}
+
+}
+
+func TestRequestID(t *testing.T) {
+	// WithRequestID(ctx context.Context, id string) context.Context
+	// RequestID(ctx context.Context) string
+
+	if id := RequestID(context.Background()); id != "" {
+		t.Error("unexpected request ID:", id)
+	}
+	var ctx = WithRequestID(context.Background(), "id")
+	if id := RequestID(ctx); id != "id" {
+		t.Error("wrong request ID:", id)
+	}
+
+}
+
+func TestLogger(t *testing.T) {
+	// Logger(ctx context.Context) *slog.Logger
+	// With(id string) *slog.Logger
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	Logger(WithRequestID(context.Background(), "id")).Info("with")
+	Logger(context.Background()).Info("without")
+
+	var rs = records(t, &buf)
+	if len(rs) != 2 {
+		t.Fatal("wrong number of records:", len(rs))
+	}
+	if rs[0]["request_id"] != "id" {
+		t.Error("missing request ID:", rs[0])
+	}
+	if _, ok := rs[1]["request_id"]; ok {
+		t.Error("unexpected request ID:", rs[1])
+	}
+
+}
@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+//go:build cockroachdb
+
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+var testDBURL = flag.String("test-db-url",
+	"postgresql://test_news_items@localhost:26257/test_news_items"+
+		"?sslmode=disable",
+	"test database URL")
+
+func TestMigrator(t *testing.T) {
+	// Up(ctx context.Context) error
+	// Down(ctx context.Context) (err error)
+	// Migrate(ctx context.Context, target int) (err error)
+	// Version(ctx context.Context) (version int, err error)
+
+	db, err := sql.Open("postgres", *testDBURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		ctx = context.Background()
+		m   = &Migrator{
+			DB:    db,
+			Table: "test_schema_version",
+			Migrations: []Migration{
+				{1, "one",
+					`CREATE TABLE test_migrations (id INT PRIMARY KEY)`,
+					`DROP TABLE test_migrations`},
+				{2, "two",
+					`ALTER TABLE test_migrations ADD COLUMN name STRING`,
+					`ALTER TABLE test_migrations DROP COLUMN name`},
+			},
+		}
+	)
+
+	// clean up
+	for _, table := range []string{m.Table, "test_migrations"} {
+		if _, err = db.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var version = func(want int) {
+		t.Helper()
+		if v, err := m.Version(ctx); err != nil {
+			t.Fatal(err)
+		} else if v != want {
+			t.Errorf("wrong version %d, want %d", v, want)
+		}
+	}
+
+	version(0)
+	if _, err = db.Exec(`SELECT 1 FROM ` + m.Table); err == nil {
+		t.Error("version table created by the Version")
+	}
+	if err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	version(2)
+	if _, err = db.Exec(`SELECT id, name FROM test_migrations`); err != nil {
+		t.Error(err)
+	}
+	if err = m.Up(ctx); err != nil { // idempotent
+		t.Fatal(err)
+	}
+	version(2)
+	if err = m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	version(1)
+	if _, err = db.Exec(`SELECT name FROM test_migrations`); err == nil {
+		t.Error("column not dropped")
+	}
+	if err = m.Migrate(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	version(0)
+	if err = m.Down(ctx); err != nil { // nothing to do
+		t.Fatal(err)
+	}
+	if err = m.Migrate(ctx, 3); err == nil {
+		t.Error("missing error")
+	}
+
+	// failed migration keeps previous version
+	m.Migrations[1].Up = `ALTER TABLE no_such_table ADD COLUMN name STRING`
+	if err = m.Up(ctx); err == nil {
+		t.Error("missing error")
+	}
+	version(1)
+
+}
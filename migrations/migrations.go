@@ -0,0 +1,288 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package migrations keeps database schema versions. Every version is
+// a pair of embedded SQL files
+//
+//	sql/NNNN_name.up.sql
+//	sql/NNNN_name.down.sql
+//
+// where NNNN is version number starting from 1 without gaps. Current
+// version is kept in schema_version table. A Migrator locks the version
+// row during every step, thus many services can be migrated at the same
+// time.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// defaults
+const (
+	VersionTable = "schema_version" // table with current version
+)
+
+// A Migration is one step of schema changes.
+type Migration struct {
+	Version int    // version after the Up
+	Name    string // human readable name
+	Up      string // SQL to upgrade from previous version
+	Down    string // SQL to downgrade to previous version
+}
+
+// Load embedded migrations ordered by version.
+func Load() (ms []Migration, err error) {
+	return load(files, "sql")
+}
+
+// load migrations from given directory of given FS
+func load(fsys fs.FS, dir string) (ms []Migration, err error) {
+
+	var names []string
+	if names, err = fs.Glob(fsys, path.Join(dir, "*.sql")); err != nil {
+		return
+	}
+
+	var byVersion = make(map[int]*Migration)
+	for _, name := range names {
+		var (
+			base      = path.Base(name)
+			direction string
+		)
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction, base = "up", strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			direction, base = "down", strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, fmt.Errorf("migration %s: unknown direction", name)
+		}
+
+		var i = strings.IndexByte(base, '_')
+		if i < 0 {
+			return nil, fmt.Errorf("migration %s: missing version", name)
+		}
+		var version int
+		if version, err = strconv.Atoi(base[:i]); err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+
+		var data []byte
+		if data, err = fs.ReadFile(fsys, name); err != nil {
+			return
+		}
+
+		var m, ok = byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[i+1:]}
+			byVersion[version] = m
+		} else if m.Name != base[i+1:] {
+			return nil, fmt.Errorf("migration %s: name mismatch", name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	for _, m := range byVersion {
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Version < ms[j].Version
+	})
+
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("missing migration %d", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s): missing up or down",
+				m.Version, m.Name)
+		}
+	}
+	return
+}
+
+// A Migrator applies migrations to a database.
+type Migrator struct {
+	DB         *sql.DB     // the database
+	Table      string      // version table name
+	Migrations []Migration // ordered by version
+}
+
+// New Migrator with embedded migrations.
+func New(db *sql.DB) (m *Migrator, err error) {
+	var ms []Migration
+	if ms, err = Load(); err != nil {
+		return
+	}
+	return &Migrator{DB: db, Table: VersionTable, Migrations: ms}, nil
+}
+
+// Latest version known.
+func (m *Migrator) Latest() int {
+	return len(m.Migrations)
+}
+
+// init creates the version table if it doesn't exist
+func (m *Migrator) init(ctx context.Context) (err error) {
+	var createTable = `CREATE TABLE IF NOT EXISTS ` + m.Table + ` (
+		id      INT PRIMARY KEY,
+		version INT NOT NULL
+	)`
+	var insertVersion = `INSERT INTO ` + m.Table + ` (id, version)
+		VALUES (1, 0) ON CONFLICT (id) DO NOTHING`
+
+	if _, err = m.DB.ExecContext(ctx, createTable); err != nil {
+		return
+	}
+	_, err = m.DB.ExecContext(ctx, insertVersion)
+	return
+}
+
+// Version of the database schema, it's zero if the version table
+// doesn't exist. It doesn't change the database.
+func (m *Migrator) Version(ctx context.Context) (version int, err error) {
+	var selectVersion = `SELECT version FROM ` + m.Table + ` WHERE id = 1`
+	err = m.DB.QueryRowContext(ctx, selectVersion).Scan(&version)
+	if err == sql.ErrNoRows || undefinedTable(err) {
+		return 0, nil // not initialized
+	}
+	return
+}
+
+// undefinedTable reports whether the err is "relation does not exist"
+// database error
+func undefinedTable(err error) bool {
+	var pe *pq.Error
+	return errors.As(err, &pe) && pe.Code == "42P01"
+}
+
+// Up migrates database to the latest version.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Migrate(ctx, m.Latest())
+}
+
+// Down migrates database one version down.
+func (m *Migrator) Down(ctx context.Context) (err error) {
+	var version int
+	if version, err = m.Version(ctx); err != nil {
+		return
+	}
+	if version == 0 {
+		return // nothing to do
+	}
+	return m.Migrate(ctx, version-1)
+}
+
+// Migrate database up or down to the given version.
+func (m *Migrator) Migrate(ctx context.Context, target int) (err error) {
+	if target < 0 || target > m.Latest() {
+		return fmt.Errorf("unknown schema version %d, latest is %d",
+			target, m.Latest())
+	}
+	if err = m.init(ctx); err != nil {
+		return
+	}
+	var done bool
+	for !done {
+		if done, err = m.step(ctx, target); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// step applies one migration towards the target under the lock of
+// version row, it returns true if the database already has the target
+// version
+func (m *Migrator) step(ctx context.Context, target int) (done bool,
+	err error) {
+
+	var lockVersion = `SELECT version FROM ` + m.Table +
+		` WHERE id = 1 FOR UPDATE`
+	var updateVersion = `UPDATE ` + m.Table +
+		` SET version = $1 WHERE id = 1`
+
+	var tx *sql.Tx
+	if tx, err = m.DB.BeginTx(ctx, nil); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var version int
+	if err = tx.QueryRowContext(ctx, lockVersion).Scan(&version); err != nil {
+		return
+	}
+	if version > m.Latest() {
+		return false, fmt.Errorf("database schema version %d is newer than"+
+			" latest known %d", version, m.Latest())
+	}
+
+	var (
+		mig  Migration
+		next int
+		stmt string
+	)
+	switch {
+	case version == target:
+		return true, nil
+	case version < target:
+		mig, next = m.Migrations[version], version+1
+		stmt = mig.Up
+	default:
+		mig, next = m.Migrations[version-1], version-1
+		stmt = mig.Down
+	}
+
+	if _, err = tx.ExecContext(ctx, stmt); err != nil {
+		return false, fmt.Errorf("migration %d (%s): %w", mig.Version,
+			mig.Name, err)
+	}
+	_, err = tx.ExecContext(ctx, updateVersion, next)
+	return
+}
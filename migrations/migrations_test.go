@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lib/pq"
+)
+
+func TestLoad(t *testing.T) {
+	// Load() (ms []Migration, err error)
+
+	ms, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) == 0 {
+		t.Fatal("no migrations")
+	}
+	if ms[0].Version != 1 || ms[0].Name != "create_news_items" {
+		t.Errorf("wrong first migration: %d %s", ms[0].Version, ms[0].Name)
+	}
+	if !strings.Contains(ms[0].Up, "header") {
+		t.Error("missing header column")
+	}
+
+}
+
+func Test_load(t *testing.T) {
+	// load(fsys fs.FS, dir string) (ms []Migration, err error)
+
+	var file = func(data string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(data)}
+	}
+
+	ms, err := load(fstest.MapFS{
+		"sql/0002_two.up.sql":   file("up 2"),
+		"sql/0002_two.down.sql": file("down 2"),
+		"sql/0001_one.up.sql":   file("up 1"),
+		"sql/0001_one.down.sql": file("down 1"),
+	}, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 {
+		t.Fatal("wrong number of migrations:", len(ms))
+	}
+	if ms[0] != (Migration{1, "one", "up 1", "down 1"}) ||
+		ms[1] != (Migration{2, "two", "up 2", "down 2"}) {
+		t.Errorf("wrong migrations: %v", ms)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"gap": {
+			"sql/0001_one.up.sql":     file("up 1"),
+			"sql/0001_one.down.sql":   file("down 1"),
+			"sql/0003_three.up.sql":   file("up 3"),
+			"sql/0003_three.down.sql": file("down 3"),
+		},
+		"missing down": {
+			"sql/0001_one.up.sql": file("up 1"),
+		},
+		"name mismatch": {
+			"sql/0001_one.up.sql":   file("up 1"),
+			"sql/0001_two.down.sql": file("down 1"),
+		},
+		"invalid version": {
+			"sql/one_one.up.sql":   file("up 1"),
+			"sql/one_one.down.sql": file("down 1"),
+		},
+		"unknown direction": {
+			"sql/0001_one.sql": file("up 1"),
+		},
+	} {
+		if _, err := load(fsys, "sql"); err == nil {
+			t.Error("missing error:", name)
+		}
+	}
+
+}
+
+func Test_undefinedTable(t *testing.T) {
+	// undefinedTable(err error) bool
+
+	var undefined = &pq.Error{Code: "42P01"}
+	if !undefinedTable(undefined) ||
+		!undefinedTable(fmt.Errorf("wrapped: %w", undefined)) {
+		t.Error("undefined table is not detected")
+	}
+	for _, err := range []error{
+		nil,
+		sql.ErrNoRows,
+		errors.New("42P01"),
+		&pq.Error{Code: "42501"}, // insufficient privilege
+	} {
+		if undefinedTable(err) {
+			t.Error("unexpected undefined table:", err)
+		}
+	}
+
+}
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS news_items (
+	id     SERIAL PRIMARY KEY,
+	header VARCHAR(255),
+	data   TEXT
+);
@@ -20,6 +20,53 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// Code of an error. The OK means no error.
+type Code int32
+
+const (
+	Code_OK                 Code = 0
+	Code_NOT_FOUND          Code = 1
+	Code_INVALID_ARGUMENT   Code = 2
+	Code_UNAVAILABLE        Code = 3
+	Code_DEADLINE_EXCEEDED  Code = 4
+	Code_INTERNAL           Code = 5
+	Code_CANCELED           Code = 6
+	Code_ALREADY_EXISTS     Code = 7
+	Code_RESOURCE_EXHAUSTED Code = 8
+)
+
+var Code_name = map[int32]string{
+	0: "OK",
+	1: "NOT_FOUND",
+	2: "INVALID_ARGUMENT",
+	3: "UNAVAILABLE",
+	4: "DEADLINE_EXCEEDED",
+	5: "INTERNAL",
+	6: "CANCELED",
+	7: "ALREADY_EXISTS",
+	8: "RESOURCE_EXHAUSTED",
+}
+
+var Code_value = map[string]int32{
+	"OK":                 0,
+	"NOT_FOUND":          1,
+	"INVALID_ARGUMENT":   2,
+	"UNAVAILABLE":        3,
+	"DEADLINE_EXCEEDED":  4,
+	"INTERNAL":           5,
+	"CANCELED":           6,
+	"ALREADY_EXISTS":     7,
+	"RESOURCE_EXHAUSTED": 8,
+}
+
+func (x Code) String() string {
+	return proto.EnumName(Code_name, int32(x))
+}
+
+func (Code) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{0}
+}
+
 // NewsItem identifier for request.
 type ID struct {
 	ID                   int64    `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
@@ -116,10 +163,12 @@ func (m *NewsItem) GetData() string {
 	return ""
 }
 
-// Response for NewsItem request with error.
+// Response for NewsItem request with error. The error is
+// detail message of the code.
 type Response struct {
 	Item                 *NewsItem `protobuf:"bytes,1,opt,name=item,proto3" json:"item,omitempty"`
 	Error                string    `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Code                 Code      `protobuf:"varint,3,opt,name=code,proto3,enum=msg.Code" json:"code,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
 	XXX_unrecognized     []byte    `json:"-"`
 	XXX_sizecache        int32     `json:"-"`
@@ -164,25 +213,587 @@ func (m *Response) GetError() string {
 	return ""
 }
 
+func (m *Response) GetCode() Code {
+	if m != nil {
+		return m.Code
+	}
+	return Code_OK
+}
+
+// InsertRequest creates new NewsItem. The ID of the item is ignored.
+// Response contains the item with ID.
+type InsertRequest struct {
+	Item                 *NewsItem `protobuf:"bytes,1,opt,name=item,proto3" json:"item,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *InsertRequest) Reset()         { *m = InsertRequest{} }
+func (m *InsertRequest) String() string { return proto.CompactTextString(m) }
+func (*InsertRequest) ProtoMessage()    {}
+func (*InsertRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{3}
+}
+
+func (m *InsertRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InsertRequest.Unmarshal(m, b)
+}
+func (m *InsertRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InsertRequest.Marshal(b, m, deterministic)
+}
+func (m *InsertRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InsertRequest.Merge(m, src)
+}
+func (m *InsertRequest) XXX_Size() int {
+	return xxx_messageInfo_InsertRequest.Size(m)
+}
+func (m *InsertRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_InsertRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InsertRequest proto.InternalMessageInfo
+
+func (m *InsertRequest) GetItem() *NewsItem {
+	if m != nil {
+		return m.Item
+	}
+	return nil
+}
+
+// UpdateRequest replaces Header and Data of existing NewsItem.
+// Response contains the updated item.
+type UpdateRequest struct {
+	Item                 *NewsItem `protobuf:"bytes,1,opt,name=item,proto3" json:"item,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *UpdateRequest) Reset()         { *m = UpdateRequest{} }
+func (m *UpdateRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdateRequest) ProtoMessage()    {}
+func (*UpdateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{4}
+}
+
+func (m *UpdateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UpdateRequest.Unmarshal(m, b)
+}
+func (m *UpdateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UpdateRequest.Marshal(b, m, deterministic)
+}
+func (m *UpdateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UpdateRequest.Merge(m, src)
+}
+func (m *UpdateRequest) XXX_Size() int {
+	return xxx_messageInfo_UpdateRequest.Size(m)
+}
+func (m *UpdateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UpdateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UpdateRequest proto.InternalMessageInfo
+
+func (m *UpdateRequest) GetItem() *NewsItem {
+	if m != nil {
+		return m.Item
+	}
+	return nil
+}
+
+// DeleteRequest removes NewsItem. Response contains no item.
+type DeleteRequest struct {
+	ID                   int64    `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteRequest) Reset()         { *m = DeleteRequest{} }
+func (m *DeleteRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteRequest) ProtoMessage()    {}
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{5}
+}
+
+func (m *DeleteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteRequest.Unmarshal(m, b)
+}
+func (m *DeleteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteRequest.Merge(m, src)
+}
+func (m *DeleteRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteRequest.Size(m)
+}
+func (m *DeleteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteRequest proto.InternalMessageInfo
+
+func (m *DeleteRequest) GetID() int64 {
+	if m != nil {
+		return m.ID
+	}
+	return 0
+}
+
+// ListRequest for NewsItems with ID greater than the after ordered
+// by ID. The limit is capped by the storage.
+type ListRequest struct {
+	After                int64    `protobuf:"varint,1,opt,name=after,proto3" json:"after,omitempty"`
+	Limit                int64    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListRequest) Reset()         { *m = ListRequest{} }
+func (m *ListRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRequest) ProtoMessage()    {}
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{6}
+}
+
+func (m *ListRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListRequest.Unmarshal(m, b)
+}
+func (m *ListRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListRequest.Marshal(b, m, deterministic)
+}
+func (m *ListRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListRequest.Merge(m, src)
+}
+func (m *ListRequest) XXX_Size() int {
+	return xxx_messageInfo_ListRequest.Size(m)
+}
+func (m *ListRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListRequest proto.InternalMessageInfo
+
+func (m *ListRequest) GetAfter() int64 {
+	if m != nil {
+		return m.After
+	}
+	return 0
+}
+
+func (m *ListRequest) GetLimit() int64 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+// ListResponse with NewsItems and error. The next is ID of the last
+// item if there can be more items after it, or zero.
+type ListResponse struct {
+	Items                []*NewsItem `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	Next                 int64       `protobuf:"varint,2,opt,name=next,proto3" json:"next,omitempty"`
+	Error                string      `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Code                 Code        `protobuf:"varint,4,opt,name=code,proto3,enum=msg.Code" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ListResponse) Reset()         { *m = ListResponse{} }
+func (m *ListResponse) String() string { return proto.CompactTextString(m) }
+func (*ListResponse) ProtoMessage()    {}
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{7}
+}
+
+func (m *ListResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListResponse.Unmarshal(m, b)
+}
+func (m *ListResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListResponse.Marshal(b, m, deterministic)
+}
+func (m *ListResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListResponse.Merge(m, src)
+}
+func (m *ListResponse) XXX_Size() int {
+	return xxx_messageInfo_ListResponse.Size(m)
+}
+func (m *ListResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListResponse proto.InternalMessageInfo
+
+func (m *ListResponse) GetItems() []*NewsItem {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+func (m *ListResponse) GetNext() int64 {
+	if m != nil {
+		return m.Next
+	}
+	return 0
+}
+
+func (m *ListResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *ListResponse) GetCode() Code {
+	if m != nil {
+		return m.Code
+	}
+	return Code_OK
+}
+
+// BatchRequest for many NewsItems by IDs.
+type BatchRequest struct {
+	IDs                  []int64  `protobuf:"varint,1,rep,packed,name=IDs,proto3" json:"IDs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BatchRequest) Reset()         { *m = BatchRequest{} }
+func (m *BatchRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchRequest) ProtoMessage()    {}
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{8}
+}
+
+func (m *BatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchRequest.Unmarshal(m, b)
+}
+func (m *BatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchRequest.Marshal(b, m, deterministic)
+}
+func (m *BatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchRequest.Merge(m, src)
+}
+func (m *BatchRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchRequest.Size(m)
+}
+func (m *BatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchRequest proto.InternalMessageInfo
+
+func (m *BatchRequest) GetIDs() []int64 {
+	if m != nil {
+		return m.IDs
+	}
+	return nil
+}
+
+// BatchError is error of one NewsItem of a batch.
+type BatchError struct {
+	ID                   int64    `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	Error                string   `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Code                 Code     `protobuf:"varint,3,opt,name=code,proto3,enum=msg.Code" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BatchError) Reset()         { *m = BatchError{} }
+func (m *BatchError) String() string { return proto.CompactTextString(m) }
+func (*BatchError) ProtoMessage()    {}
+func (*BatchError) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{9}
+}
+
+func (m *BatchError) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchError.Unmarshal(m, b)
+}
+func (m *BatchError) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchError.Marshal(b, m, deterministic)
+}
+func (m *BatchError) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchError.Merge(m, src)
+}
+func (m *BatchError) XXX_Size() int {
+	return xxx_messageInfo_BatchError.Size(m)
+}
+func (m *BatchError) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchError.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchError proto.InternalMessageInfo
+
+func (m *BatchError) GetID() int64 {
+	if m != nil {
+		return m.ID
+	}
+	return 0
+}
+
+func (m *BatchError) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *BatchError) GetCode() Code {
+	if m != nil {
+		return m.Code
+	}
+	return Code_OK
+}
+
+// BatchResponse with found NewsItems in order of requested IDs, errors
+// of missing NewsItems and error of entire batch.
+type BatchResponse struct {
+	Items                []*NewsItem   `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	Errors               []*BatchError `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	Error                string        `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Code                 Code          `protobuf:"varint,4,opt,name=code,proto3,enum=msg.Code" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *BatchResponse) Reset()         { *m = BatchResponse{} }
+func (m *BatchResponse) String() string { return proto.CompactTextString(m) }
+func (*BatchResponse) ProtoMessage()    {}
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{10}
+}
+
+func (m *BatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchResponse.Unmarshal(m, b)
+}
+func (m *BatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchResponse.Marshal(b, m, deterministic)
+}
+func (m *BatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchResponse.Merge(m, src)
+}
+func (m *BatchResponse) XXX_Size() int {
+	return xxx_messageInfo_BatchResponse.Size(m)
+}
+func (m *BatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchResponse proto.InternalMessageInfo
+
+func (m *BatchResponse) GetItems() []*NewsItem {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+func (m *BatchResponse) GetErrors() []*BatchError {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+func (m *BatchResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *BatchResponse) GetCode() Code {
+	if m != nil {
+		return m.Code
+	}
+	return Code_OK
+}
+
+// HealthRequest pings storage services. Every storage service
+// instance answers it.
+type HealthRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthRequest) Reset()         { *m = HealthRequest{} }
+func (m *HealthRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthRequest) ProtoMessage()    {}
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{11}
+}
+
+func (m *HealthRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthRequest.Unmarshal(m, b)
+}
+func (m *HealthRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthRequest.Marshal(b, m, deterministic)
+}
+func (m *HealthRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthRequest.Merge(m, src)
+}
+func (m *HealthRequest) XXX_Size() int {
+	return xxx_messageInfo_HealthRequest.Size(m)
+}
+func (m *HealthRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthRequest proto.InternalMessageInfo
+
+// HealthResponse describes a storage service instance. The DB is
+// "ok" or error of the database ping.
+type HealthResponse struct {
+	Instance             string   `protobuf:"bytes,1,opt,name=instance,proto3" json:"instance,omitempty"`
+	Version              string   `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Uptime               int64    `protobuf:"varint,3,opt,name=uptime,proto3" json:"uptime,omitempty"`
+	DB                   string   `protobuf:"bytes,4,opt,name=DB,proto3" json:"DB,omitempty"`
+	InFlight             int64    `protobuf:"varint,5,opt,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`
+	Error                string   `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	Code                 Code     `protobuf:"varint,7,opt,name=code,proto3,enum=msg.Code" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthResponse) Reset()         { *m = HealthResponse{} }
+func (m *HealthResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthResponse) ProtoMessage()    {}
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d0f0a1b324c95b77, []int{12}
+}
+
+func (m *HealthResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthResponse.Unmarshal(m, b)
+}
+func (m *HealthResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthResponse.Marshal(b, m, deterministic)
+}
+func (m *HealthResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthResponse.Merge(m, src)
+}
+func (m *HealthResponse) XXX_Size() int {
+	return xxx_messageInfo_HealthResponse.Size(m)
+}
+func (m *HealthResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthResponse proto.InternalMessageInfo
+
+func (m *HealthResponse) GetInstance() string {
+	if m != nil {
+		return m.Instance
+	}
+	return ""
+}
+
+func (m *HealthResponse) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *HealthResponse) GetUptime() int64 {
+	if m != nil {
+		return m.Uptime
+	}
+	return 0
+}
+
+func (m *HealthResponse) GetDB() string {
+	if m != nil {
+		return m.DB
+	}
+	return ""
+}
+
+func (m *HealthResponse) GetInFlight() int64 {
+	if m != nil {
+		return m.InFlight
+	}
+	return 0
+}
+
+func (m *HealthResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *HealthResponse) GetCode() Code {
+	if m != nil {
+		return m.Code
+	}
+	return Code_OK
+}
+
 func init() {
+	proto.RegisterEnum("msg.Code", Code_name, Code_value)
 	proto.RegisterType((*ID)(nil), "msg.ID")
 	proto.RegisterType((*NewsItem)(nil), "msg.NewsItem")
 	proto.RegisterType((*Response)(nil), "msg.Response")
+	proto.RegisterType((*InsertRequest)(nil), "msg.InsertRequest")
+	proto.RegisterType((*UpdateRequest)(nil), "msg.UpdateRequest")
+	proto.RegisterType((*DeleteRequest)(nil), "msg.DeleteRequest")
+	proto.RegisterType((*ListRequest)(nil), "msg.ListRequest")
+	proto.RegisterType((*ListResponse)(nil), "msg.ListResponse")
+	proto.RegisterType((*BatchRequest)(nil), "msg.BatchRequest")
+	proto.RegisterType((*BatchError)(nil), "msg.BatchError")
+	proto.RegisterType((*BatchResponse)(nil), "msg.BatchResponse")
+	proto.RegisterType((*HealthRequest)(nil), "msg.HealthRequest")
+	proto.RegisterType((*HealthResponse)(nil), "msg.HealthResponse")
 }
 
 func init() { proto.RegisterFile("msg/msg.proto", fileDescriptor_d0f0a1b324c95b77) }
 
 var fileDescriptor_d0f0a1b324c95b77 = []byte{
-	// 161 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcd, 0x2d, 0x4e, 0xd7,
-	0xcf, 0x2d, 0x4e, 0xd7, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0xce, 0x2d, 0x4e, 0x57, 0x12,
-	0xe1, 0x62, 0xf2, 0x74, 0x11, 0xe2, 0x03, 0x91, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0xcc, 0x41, 0x4c,
-	0x9e, 0x2e, 0x4a, 0x6e, 0x5c, 0x1c, 0x7e, 0xa9, 0xe5, 0xc5, 0x9e, 0x25, 0xa9, 0xb9, 0xe8, 0x72,
-	0x42, 0x62, 0x5c, 0x6c, 0x1e, 0xa9, 0x89, 0x29, 0xa9, 0x45, 0x12, 0x4c, 0x0a, 0x8c, 0x1a, 0x9c,
-	0x41, 0x50, 0x9e, 0x90, 0x10, 0x17, 0x8b, 0x4b, 0x62, 0x49, 0xa2, 0x04, 0x33, 0x58, 0x14, 0xcc,
-	0x56, 0x72, 0xe6, 0xe2, 0x08, 0x4a, 0x2d, 0x2e, 0xc8, 0xcf, 0x2b, 0x4e, 0x15, 0x52, 0xe4, 0x62,
-	0xc9, 0x2c, 0x49, 0xcd, 0x05, 0x9b, 0xc4, 0x6d, 0xc4, 0xab, 0x07, 0x72, 0x08, 0xcc, 0x92, 0x20,
-	0xb0, 0x94, 0x90, 0x08, 0x17, 0x6b, 0x6a, 0x51, 0x51, 0x3e, 0xcc, 0x64, 0x08, 0x27, 0x89, 0x0d,
-	0xec, 0x5c, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0xdf, 0x98, 0x51, 0x17, 0xbf, 0x00, 0x00,
-	0x00,
+	// 562 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9d, 0x54, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0xb1, 0xe3, 0xc4, 0x93, 0x38, 0x31, 0xab, 0x82, 0x22, 0x10, 0xa2, 0x98, 0x43, 0x11,
+	0x87, 0x22, 0x85, 0x13, 0x47, 0x27, 0xbb, 0xa1, 0x16, 0xc6, 0x11, 0x9b, 0xb8, 0x82, 0x53, 0xe4,
+	0x26, 0xdb, 0xd6, 0x52, 0x62, 0x07, 0x7b, 0x0b, 0x1c, 0x78, 0x0a, 0x5e, 0x81, 0x17, 0xe1, 0xd1,
+	0xd8, 0x5d, 0xdb, 0x8d, 0x14, 0x72, 0xa0, 0x3d, 0xd8, 0x9a, 0x6f, 0x7e, 0xbe, 0x99, 0xf9, 0xbc,
+	0x6b, 0xb0, 0x37, 0xc5, 0xd5, 0x1b, 0xf1, 0x9c, 0x6e, 0xf3, 0x8c, 0x67, 0x48, 0x17, 0xa6, 0x7b,
+	0x04, 0x0d, 0x1f, 0xa3, 0x9e, 0x7c, 0x0f, 0xb4, 0x63, 0xed, 0x95, 0x4e, 0x85, 0xe5, 0x4e, 0xa0,
+	0x1d, 0xb2, 0xef, 0x85, 0xcf, 0xd9, 0x66, 0x3f, 0x86, 0x1e, 0x83, 0x79, 0xc6, 0xe2, 0x15, 0xcb,
+	0x07, 0x0d, 0xe1, 0xb3, 0x68, 0x85, 0x10, 0x02, 0x03, 0xc7, 0x3c, 0x1e, 0xe8, 0xca, 0xab, 0x6c,
+	0xf7, 0x02, 0xda, 0x94, 0x15, 0xdb, 0x2c, 0x2d, 0x18, 0x7a, 0x01, 0x46, 0x22, 0xf8, 0x14, 0x53,
+	0x67, 0x68, 0x9f, 0xca, 0x41, 0xea, 0x26, 0x54, 0x85, 0xd0, 0x11, 0x34, 0x59, 0x9e, 0x67, 0x35,
+	0x73, 0x09, 0xd0, 0x33, 0x30, 0x96, 0xd9, 0x8a, 0x29, 0xe2, 0xde, 0xd0, 0x52, 0x85, 0x63, 0xe1,
+	0xa0, 0xca, 0xed, 0x0e, 0xc1, 0xf6, 0x05, 0x7f, 0xce, 0x29, 0xfb, 0x7a, 0xc3, 0x0a, 0xfe, 0x1f,
+	0x8d, 0x64, 0x4d, 0xb4, 0x5d, 0xc5, 0x9c, 0xdd, 0xa1, 0xe6, 0x39, 0xd8, 0x98, 0xad, 0xd9, 0xae,
+	0x66, 0x5f, 0xb4, 0x77, 0xd0, 0x09, 0x92, 0xe2, 0x76, 0x0c, 0xb1, 0x4c, 0x7c, 0xc9, 0x85, 0x4c,
+	0x65, 0x46, 0x09, 0xa4, 0x77, 0x9d, 0x6c, 0x12, 0xae, 0x56, 0x14, 0x5e, 0x05, 0xdc, 0x9f, 0xd0,
+	0x2d, 0x4b, 0x2b, 0xad, 0x5e, 0x42, 0x53, 0xf6, 0x2c, 0x44, 0xad, 0xfe, 0xef, 0x3c, 0x65, 0x4c,
+	0x0a, 0x9e, 0xb2, 0x1f, 0x35, 0x93, 0xb2, 0x77, 0x0a, 0xea, 0x87, 0x14, 0x34, 0x0e, 0x2b, 0x78,
+	0x0c, 0xdd, 0x51, 0xcc, 0x97, 0xd7, 0xf5, 0xe4, 0x0e, 0xe8, 0x3e, 0x2e, 0x7b, 0xeb, 0x54, 0x9a,
+	0xee, 0x27, 0x00, 0x95, 0x41, 0x14, 0xdd, 0xfe, 0x89, 0xb8, 0xd7, 0x67, 0xfb, 0xa5, 0x81, 0x5d,
+	0x75, 0xbd, 0xcb, 0xd2, 0x27, 0x60, 0x2a, 0xfa, 0x42, 0x34, 0x93, 0x59, 0x7d, 0x95, 0xb5, 0x1b,
+	0x8e, 0x56, 0xe1, 0xfb, 0x29, 0xd1, 0x07, 0x5b, 0x9c, 0xe6, 0x35, 0xaf, 0xa5, 0x70, 0xff, 0x68,
+	0xd0, 0xab, 0x3d, 0xd5, 0x98, 0x4f, 0xa0, 0x9d, 0xa4, 0x05, 0x8f, 0xd3, 0x25, 0x53, 0x1a, 0x58,
+	0xf4, 0x16, 0xa3, 0x01, 0xb4, 0xbe, 0xb1, 0xbc, 0x48, 0xb2, 0xb4, 0xd2, 0xa2, 0x86, 0xf2, 0xd6,
+	0xdc, 0x6c, 0x79, 0xb2, 0x29, 0xf5, 0xd0, 0x69, 0x85, 0xa4, 0x96, 0x78, 0xa4, 0xc6, 0xb1, 0xa8,
+	0xb0, 0xd0, 0x53, 0xb0, 0x92, 0x74, 0x71, 0xb9, 0x4e, 0xae, 0xae, 0xf9, 0xa0, 0xa9, 0x52, 0x05,
+	0xfd, 0x44, 0xe1, 0xdd, 0x4e, 0xe6, 0xa1, 0x9d, 0x5a, 0x07, 0x77, 0x7a, 0xfd, 0x5b, 0x03, 0x43,
+	0x42, 0x64, 0x42, 0x63, 0xfa, 0xc1, 0x79, 0x80, 0x6c, 0xb0, 0xc2, 0xe9, 0x7c, 0x31, 0x99, 0x46,
+	0x21, 0x76, 0x34, 0x41, 0xea, 0xf8, 0xe1, 0xb9, 0x17, 0xf8, 0x78, 0xe1, 0xd1, 0xf7, 0xd1, 0x47,
+	0x12, 0xce, 0x9d, 0x06, 0xea, 0x43, 0x27, 0x0a, 0xbd, 0x73, 0xcf, 0x0f, 0xbc, 0x51, 0x40, 0x1c,
+	0x1d, 0x3d, 0x82, 0x87, 0x98, 0x78, 0x38, 0xf0, 0x43, 0xb2, 0x20, 0x9f, 0xc7, 0x84, 0x60, 0x82,
+	0x1d, 0x03, 0x75, 0xa1, 0xed, 0x87, 0x73, 0x42, 0x43, 0x2f, 0x70, 0x9a, 0x12, 0x8d, 0xbd, 0x70,
+	0x4c, 0x02, 0x11, 0x33, 0xc5, 0x01, 0xed, 0x79, 0x01, 0x15, 0x45, 0x5f, 0x44, 0x85, 0x3f, 0x9b,
+	0xcf, 0x9c, 0x96, 0xd0, 0x01, 0x51, 0x32, 0x9b, 0x46, 0x74, 0x2c, 0x69, 0xce, 0xbc, 0x68, 0x36,
+	0x17, 0xb9, 0xed, 0x0b, 0x53, 0xfd, 0x93, 0xde, 0xfe, 0x05, 0xdb, 0x9e, 0x67, 0x66, 0xa4, 0x04,
+	0x00, 0x00,
 }
@@ -0,0 +1,38 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package msg
+
+// Suffixes of NATS subjects. A subject of an operation is
+// the base subject (from a Config) with the suffix. The base
+// subject itself is used to get a NewsItem by ID.
+const (
+	InsertSuffix = ".insert" // InsertRequest -> Response
+	UpdateSuffix = ".update" // UpdateRequest -> Response
+	DeleteSuffix = ".delete" // DeleteRequest -> Response
+	ListSuffix   = ".list"   // ListRequest -> ListResponse
+	BatchSuffix  = ".batch"  // BatchRequest -> BatchResponse
+	HealthSuffix = ".health" // HealthRequest -> HealthResponse, no queue
+)
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package natsconf represents NATS connection settings shared by
+// the storage and the queryClient.
+package natsconf
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// defaults
+const (
+	MaxReconnects        = -1                           // reconnect forever
+	ReconnectWait        = nats.DefaultReconnectWait    // between attempts
+	ReconnectJitter      = nats.DefaultReconnectJitter  // added to the wait
+	ReconnectBufSize     = nats.DefaultReconnectBufSize // while reconnecting
+	RetryOnFailedConnect = true                         // start without NATS
+)
+
+// A Config represents NATS authentication and TLS settings. Only one
+// authentication method can be used. All fields are optional.
+type Config struct {
+
+	// Authentication
+
+	CredsFile string // credentials file (user JWT and NKey seed)
+	NKeyFile  string // NKey seed file
+	User      string // user name
+	Password  string // user password
+	Token     string // authentication token
+
+	// TLS
+
+	TLSCA   string // CA certificate file
+	TLSCert string // client certificate file
+	TLSKey  string // client key file
+
+	// Reconnect policy
+
+	MaxReconnects        int           // max attempts, -1 for forever
+	ReconnectWait        time.Duration // wait between attempts
+	ReconnectJitter      time.Duration // max random time added to the wait
+	ReconnectBufSize     int           // buffer for publications, bytes
+	RetryOnFailedConnect bool          // reconnect if first connect fails
+}
+
+// NewConfig with defaults.
+func NewConfig() (c *Config) {
+	c = new(Config)
+	c.MaxReconnects = MaxReconnects
+	c.ReconnectWait = ReconnectWait
+	c.ReconnectJitter = ReconnectJitter
+	c.ReconnectBufSize = ReconnectBufSize
+	c.RetryOnFailedConnect = RetryOnFailedConnect
+	return
+}
+
+// FromFlags obtains config values from command-line flags.
+// The prefix argument used to prefix all the flags with the
+// given prefix.
+func (c *Config) FromFlags(fset *flag.FlagSet, prefix string) {
+	fset.StringVar(&c.CredsFile,
+		prefix+"nats-creds",
+		c.CredsFile,
+		"NATS credentials file")
+	fset.StringVar(&c.NKeyFile,
+		prefix+"nats-nkey",
+		c.NKeyFile,
+		"NATS NKey seed file")
+	fset.StringVar(&c.User,
+		prefix+"nats-user",
+		c.User,
+		"NATS user name")
+	fset.StringVar(&c.Password,
+		prefix+"nats-password",
+		c.Password,
+		"NATS user password")
+	fset.StringVar(&c.Token,
+		prefix+"nats-token",
+		c.Token,
+		"NATS authentication token")
+	fset.StringVar(&c.TLSCA,
+		prefix+"nats-tls-ca",
+		c.TLSCA,
+		"NATS CA certificate file")
+	fset.StringVar(&c.TLSCert,
+		prefix+"nats-tls-cert",
+		c.TLSCert,
+		"NATS client certificate file")
+	fset.StringVar(&c.TLSKey,
+		prefix+"nats-tls-key",
+		c.TLSKey,
+		"NATS client key file")
+	fset.IntVar(&c.MaxReconnects,
+		prefix+"nats-max-reconnects",
+		c.MaxReconnects,
+		"NATS max reconnect attempts, -1 for forever")
+	fset.DurationVar(&c.ReconnectWait,
+		prefix+"nats-reconnect-wait",
+		c.ReconnectWait,
+		"NATS wait between reconnect attempts")
+	fset.DurationVar(&c.ReconnectJitter,
+		prefix+"nats-reconnect-jitter",
+		c.ReconnectJitter,
+		"NATS max random time added to the reconnect wait")
+	fset.IntVar(&c.ReconnectBufSize,
+		prefix+"nats-reconnect-buf-size",
+		c.ReconnectBufSize,
+		"NATS buffer size for publications while reconnecting, bytes")
+	fset.BoolVar(&c.RetryOnFailedConnect,
+		prefix+"nats-retry-on-failed-connect",
+		c.RetryOnFailedConnect,
+		"start without NATS and connect in background")
+}
+
+// Validate the Config: only one authentication method, TLS
+// certificate with its key and non-negative reconnect settings.
+func (c *Config) Validate() error {
+
+	var methods int
+	for _, set := range []bool{
+		c.CredsFile != "",
+		c.NKeyFile != "",
+		c.User != "",
+		c.Token != "",
+	} {
+		if set {
+			methods++
+		}
+	}
+	switch {
+	case methods > 1:
+		return errors.New("more than one NATS authentication method")
+	case c.Password != "" && c.User == "":
+		return errors.New("NATS password without user")
+	case (c.TLSCert == "") != (c.TLSKey == ""):
+		return errors.New("NATS TLS certificate and key must be" +
+			" set together")
+	case c.MaxReconnects < -1:
+		return fmt.Errorf("invalid NATS max reconnects: %d", c.MaxReconnects)
+	case c.ReconnectWait < 0:
+		return fmt.Errorf("negative NATS reconnect wait: %s", c.ReconnectWait)
+	case c.ReconnectJitter < 0:
+		return fmt.Errorf("negative NATS reconnect jitter: %s",
+			c.ReconnectJitter)
+	}
+	return nil
+}
+
+// Options returns NATS connection options based on the Config.
+func (c *Config) Options() (opts []nats.Option, err error) {
+	if err = c.Validate(); err != nil {
+		return
+	}
+
+	switch {
+	case c.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(c.CredsFile))
+	case c.NKeyFile != "":
+		var opt nats.Option
+		if opt, err = nats.NkeyOptionFromSeed(c.NKeyFile); err != nil {
+			return nil, fmt.Errorf("loading NATS NKey: %w", err)
+		}
+		opts = append(opts, opt)
+	case c.User != "":
+		opts = append(opts, nats.UserInfo(c.User, c.Password))
+	case c.Token != "":
+		opts = append(opts, nats.Token(c.Token))
+	}
+
+	if c.TLSCA != "" {
+		opts = append(opts, nats.RootCAs(c.TLSCA))
+	}
+	if c.TLSCert != "" {
+		opts = append(opts, nats.ClientCert(c.TLSCert, c.TLSKey))
+	}
+
+	opts = append(opts,
+		nats.MaxReconnects(c.MaxReconnects),
+		nats.ReconnectWait(c.ReconnectWait),
+		nats.ReconnectJitter(c.ReconnectJitter, c.ReconnectJitter),
+		nats.ReconnectBufSize(c.ReconnectBufSize),
+		nats.RetryOnFailedConnect(c.RetryOnFailedConnect),
+	)
+	return
+}
+
+// Handlers returns NATS options logging connection state changes and
+// asynchronous errors. The notify function, if not nil, is called
+// on every state change with nats.DISCONNECTED, nats.CONNECTED (after
+// a reconnect) or nats.CLOSED status.
+func Handlers(notify func(nc *nats.Conn, status nats.Status)) []nats.Option {
+	if notify == nil {
+		notify = func(*nats.Conn, nats.Status) {}
+	}
+	return []nats.Option{
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			slog.Info("NATS connected", "url", nc.ConnectedUrlRedacted())
+		}),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			if err != nil {
+				slog.Warn("NATS disconnected", "error", err)
+			} else {
+				slog.Info("NATS disconnected")
+			}
+			notify(nc, nats.DISCONNECTED)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			slog.Info("NATS reconnected", "url", nc.ConnectedUrlRedacted())
+			notify(nc, nats.CONNECTED)
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			slog.Info("NATS connection closed")
+			notify(nc, nats.CLOSED)
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, s *nats.Subscription, err error) {
+			if s != nil {
+				slog.Error("NATS subscription error", "subject", s.Subject,
+					"error", err)
+				return
+			}
+			slog.Error("NATS error", "error", err)
+		}),
+	}
+}
@@ -0,0 +1,329 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package natsconf
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+
+	"github.com/logrusorgru/news_micro_storage_system/certtest"
+	"github.com/logrusorgru/news_micro_storage_system/natstest"
+)
+
+// testServer starts embedded NATS server on random port
+func testServer(t *testing.T, opts *server.Options) (url string) {
+	return natstest.Run(t, opts)
+}
+
+// testConnect returns connection error
+func testConnect(t *testing.T, url string, conf *Config) error {
+	opts, err := conf.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := nats.Connect(url, append(opts, nats.NoReconnect())...)
+	if err != nil {
+		return err
+	}
+	nc.Close()
+	return nil
+}
+
+func TestNewConfig(t *testing.T) {
+	// NewConfig() (c *Config)
+
+	conf := NewConfig()
+	isDefault := (conf.MaxReconnects == MaxReconnects) &&
+		(conf.ReconnectWait == ReconnectWait) &&
+		(conf.ReconnectJitter == ReconnectJitter) &&
+		(conf.ReconnectBufSize == ReconnectBufSize) &&
+		(conf.RetryOnFailedConnect == RetryOnFailedConnect)
+
+	if !isDefault {
+		t.Error("NewConfig contains non-default values")
+	}
+
+}
+
+func TestConfig_FromFlags(t *testing.T) {
+	// FromFlags(fset *flag.FlagSet, prefix string)
+
+	var fset = flag.NewFlagSet("test-set", flag.ContinueOnError)
+	var conf = NewConfig()
+
+	conf.FromFlags(fset, "x-")
+	err := fset.Parse([]string{
+		"-x-nats-creds", "creds",
+		"-x-nats-nkey", "nkey",
+		"-x-nats-user", "user",
+		"-x-nats-password", "pass",
+		"-x-nats-token", "token",
+		"-x-nats-tls-ca", "ca",
+		"-x-nats-tls-cert", "cert",
+		"-x-nats-tls-key", "key",
+		"-x-nats-max-reconnects", "10",
+		"-x-nats-reconnect-wait", "1s",
+		"-x-nats-reconnect-jitter", "2s",
+		"-x-nats-reconnect-buf-size", "1024",
+		"-x-nats-retry-on-failed-connect=false",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *conf != (Config{"creds", "nkey", "user", "pass", "token",
+		"ca", "cert", "key", 10, time.Second, 2 * time.Second, 1024,
+		false}) {
+		t.Errorf("incorrect arguments parsing: %+v", conf)
+	}
+
+}
+
+func TestConfig_Validate(t *testing.T) {
+	// Validate() error
+
+	if err := NewConfig().Validate(); err != nil {
+		t.Error(err)
+	}
+
+	for name, conf := range map[string]Config{
+		"user and token":   {User: "user", Token: "token"},
+		"password only":    {Password: "pass"},
+		"cert without key": {TLSCert: "cert"},
+		"max reconnects":   {MaxReconnects: -2},
+		"reconnect wait":   {ReconnectWait: -time.Second},
+		"reconnect jitter": {ReconnectJitter: -time.Second},
+	} {
+		if err := conf.Validate(); err == nil {
+			t.Error("missing error:", name)
+		}
+	}
+
+}
+
+func TestConfig_Options(t *testing.T) {
+	// Options() (opts []nats.Option, err error)
+
+	if opts, err := new(Config).Options(); err != nil {
+		t.Error(err)
+	} else if len(opts) != 5 { // reconnect policy only
+		t.Error("unexpected options:", len(opts))
+	}
+
+	for name, conf := range map[string]Config{
+		"user and token":    {User: "user", Token: "token"},
+		"creds and nkey":    {CredsFile: "creds", NKeyFile: "nkey"},
+		"password only":     {Password: "pass"},
+		"cert without key":  {TLSCert: "cert"},
+		"key without cert":  {TLSKey: "key"},
+		"missing nkey file": {NKeyFile: "/no/such/file"},
+	} {
+		if _, err := conf.Options(); err == nil {
+			t.Error("missing error:", name)
+		}
+	}
+
+}
+
+func TestConfig_Options_user(t *testing.T) {
+	var url = testServer(t, &server.Options{
+		Username: "user",
+		Password: "pass",
+	})
+
+	if err := testConnect(t, url, &Config{User: "user",
+		Password: "pass"}); err != nil {
+		t.Error(err)
+	}
+	if err := testConnect(t, url, &Config{User: "user",
+		Password: "wrong"}); err == nil {
+		t.Error("connected with wrong password")
+	}
+	if err := testConnect(t, url, &Config{}); err == nil {
+		t.Error("connected without credentials")
+	}
+}
+
+func TestConfig_Options_token(t *testing.T) {
+	var url = testServer(t, &server.Options{Authorization: "secret"})
+
+	if err := testConnect(t, url, &Config{Token: "secret"}); err != nil {
+		t.Error(err)
+	}
+	if err := testConnect(t, url, &Config{Token: "wrong"}); err == nil {
+		t.Error("connected with wrong token")
+	}
+}
+
+func TestConfig_Options_nkey(t *testing.T) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file = filepath.Join(t.TempDir(), "user.nk")
+	if err = os.WriteFile(file, seed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var url = testServer(t, &server.Options{
+		Nkeys: []*server.NkeyUser{{Nkey: pub}},
+	})
+
+	if err := testConnect(t, url, &Config{NKeyFile: file}); err != nil {
+		t.Error(err)
+	}
+	if err := testConnect(t, url, &Config{}); err == nil {
+		t.Error("connected without NKey")
+	}
+}
+
+func TestConfig_Options_tls(t *testing.T) {
+	var certs = certtest.Generate(t, t.TempDir(), "client")
+	var url = testServer(t, &server.Options{
+		TLS:       true,
+		TLSVerify: true,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{certs.Server},
+			ClientCAs:    certs.Pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		},
+		TLSTimeout: 2,
+	})
+
+	var conf = Config{
+		TLSCA:   certs.CA,
+		TLSCert: certs.ClientCert,
+		TLSKey:  certs.ClientKey,
+	}
+	if err := testConnect(t, url, &conf); err != nil {
+		t.Error(err)
+	}
+
+	conf.TLSCert, conf.TLSKey = "", ""
+	if err := testConnect(t, url, &conf); err == nil {
+		t.Error("connected without client certificate")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	// Handlers(notify func(nc *nats.Conn, status nats.Status)) []nats.Option
+
+	// free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	var start = func() *server.Server {
+		s, err := server.NewServer(&server.Options{
+			Host:   "127.0.0.1",
+			Port:   port,
+			NoLog:  true,
+			NoSigs: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.Start()
+		if !s.ReadyForConnections(5 * time.Second) {
+			t.Fatal("NATS server is not ready")
+		}
+		return s
+	}
+
+	var conf = NewConfig()
+	conf.ReconnectWait = 10 * time.Millisecond
+	conf.ReconnectJitter = 0
+	opts, err := conf.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var states = make(chan nats.Status, 10)
+	opts = append(opts, Handlers(func(_ *nats.Conn, status nats.Status) {
+		states <- status
+	})...)
+
+	var expect = func(want nats.Status) {
+		t.Helper()
+		select {
+		case status := <-states:
+			if status != want {
+				t.Errorf("unexpected state %s, want %s", status, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing state:", want)
+		}
+	}
+
+	// retry on failed connect, start without NATS
+	nc, err := nats.Connect(fmt.Sprintf("nats://127.0.0.1:%d", port),
+		opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	var s = start()
+	for i := 0; !nc.IsConnected(); i++ {
+		if i == 500 {
+			t.Fatal("not connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.Shutdown()
+	expect(nats.DISCONNECTED)
+
+	s = start()
+	defer s.Shutdown()
+	expect(nats.CONNECTED)
+
+	nc.Close()
+	expect(nats.DISCONNECTED)
+	expect(nats.CLOSED)
+}
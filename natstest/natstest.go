@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package natstest runs embedded NATS server for tests, thus tests
+// don't need external nats-server.
+package natstest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// ReadyTimeout is max time to wait for a started server.
+const ReadyTimeout = 5 * time.Second
+
+// NewServer starts embedded NATS server on a random port of the
+// localhost. The opts can be nil. Shutdown the server after use.
+func NewServer(opts *server.Options) (s *server.Server, err error) {
+	if opts == nil {
+		opts = new(server.Options)
+	}
+	opts.Host, opts.Port = "127.0.0.1", -1
+	opts.NoLog, opts.NoSigs = true, true
+	if s, err = server.NewServer(opts); err != nil {
+		return
+	}
+	go s.Start()
+	if !s.ReadyForConnections(ReadyTimeout) {
+		s.Shutdown()
+		return nil, errors.New("NATS server is not ready")
+	}
+	return
+}
+
+// Run starts embedded NATS server for the test and shuts it down
+// when the test finishes. It returns client URL of the server.
+func Run(t testing.TB, opts *server.Options) (url string) {
+	t.Helper()
+	s, err := NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Shutdown)
+	return s.ClientURL()
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package natstest
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNewServer(t *testing.T) {
+	// NewServer(opts *server.Options) (s *server.Server, err error)
+
+	s, err := NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Close()
+
+}
+
+func TestRun(t *testing.T) {
+	// Run(t testing.TB, opts *server.Options) (url string)
+
+	var url = Run(t, &server.Options{Authorization: "secret"})
+	if nc, err := nats.Connect(url); err == nil {
+		nc.Close()
+		t.Error("connected without token")
+	}
+	nc, err := nats.Connect(url, nats.Token("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Close()
+
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package queryClient
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// health statuses
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// A Health represents JSON body of the /healthz and the /readyz.
+type Health struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// A Check represents status of a dependency.
+type Check struct {
+	Status   string  `json:"status"`
+	Latency  float64 `json:"latency_ms"`
+	Instance string  `json:"instance,omitempty"` // storage instance
+	Error    string  `json:"error,omitempty"`
+}
+
+// latency in milliseconds
+func latency(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
+
+// GET /healthz, the process is alive
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, Health{Status: StatusOK})
+}
+
+// GET /readyz, NATS is connected, if used, and a storage service answers
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	var h = Health{
+		Status: StatusOK,
+		Checks: map[string]Check{
+			"storage": s.checkStorage(r.Context()),
+		},
+	}
+	if s.Conn != nil {
+		h.Checks["nats"] = s.checkNATS()
+	}
+	var status = http.StatusOK
+	for _, c := range h.Checks {
+		if c.Status != StatusOK {
+			h.Status, status = StatusUnavailable, http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, r, status, h)
+}
+
+// checkNATS connection status and round trip to NATS server
+func (s *Server) checkNATS() (c Check) {
+	if st := s.Conn.Status(); st != nats.CONNECTED {
+		return Check{Status: StatusUnavailable, Error: st.String()}
+	}
+	rtt, err := s.Conn.RTT()
+	if err != nil {
+		return Check{Status: StatusUnavailable, Error: err.Error()}
+	}
+	c.Status = StatusOK
+	c.Latency = float64(rtt) / float64(time.Millisecond)
+	return
+}
+
+// checkStorage pings storage services using the health subject,
+// the first answered instance is checked
+func (s *Server) checkStorage(ctx context.Context) (c Check) {
+	ctx, cancel := context.WithTimeout(ctx, s.Conf.ReadyTimeout)
+	defer cancel()
+
+	var start = time.Now()
+	hrsp, err := s.Client.Health(ctx)
+	c.Latency = latency(start)
+	if err != nil {
+		c.Status, c.Error = StatusUnavailable, err.Error()
+		return
+	}
+	c.Instance = hrsp.Instance
+	if hrsp.DB != "ok" {
+		c.Status, c.Error = StatusUnavailable, "database: "+hrsp.DB
+		return
+	}
+	c.Status = StatusOK
+	return
+}
@@ -0,0 +1,153 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package queryClient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+	"github.com/nats-io/nats.go"
+)
+
+func requestHealth(t *testing.T, s *Server, path string) (status int,
+	h Health) {
+
+	var rec = httptest.NewRecorder()
+	s.Server.Handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, h
+}
+
+func TestServer_healthz(t *testing.T) {
+
+	s, err := NewServer(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if st, h := requestHealth(t, s, "/healthz"); st != 200 {
+		t.Error("wrong status:", st)
+	} else if h.Status != StatusOK {
+		t.Error("wrong health status:", h.Status)
+	}
+
+}
+
+func TestServer_readyz(t *testing.T) {
+
+	var conf = testConf
+	conf.Subject = testConf.Subject + "_readyz"
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// no storage
+	st, h := requestHealth(t, s, "/readyz")
+	if st != http.StatusServiceUnavailable {
+		t.Error("wrong status:", st)
+	}
+	if h.Status != StatusUnavailable {
+		t.Error("wrong health status:", h.Status)
+	}
+	if c := h.Checks["nats"]; c.Status != StatusOK {
+		t.Errorf("wrong NATS check: %+v", c)
+	}
+	if c := h.Checks["storage"]; c.Status != StatusUnavailable ||
+		c.Error == "" {
+		t.Errorf("wrong storage check: %+v", c)
+	}
+
+	// storage
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	var db atomic.Value
+	db.Store("ok")
+	_, err = nc.Subscribe(conf.Subject+msg.HealthSuffix,
+		func(req *nats.Msg) {
+			val, err := proto.Marshal(&msg.HealthResponse{
+				Instance: "test-instance",
+				DB:       db.Load().(string),
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			req.Respond(val)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	st, h = requestHealth(t, s, "/readyz")
+	if st != http.StatusOK {
+		t.Error("wrong status:", st)
+	}
+	if h.Status != StatusOK {
+		t.Error("wrong health status:", h.Status)
+	}
+	if c := h.Checks["storage"]; c.Status != StatusOK || c.Latency <= 0 ||
+		c.Instance != "test-instance" {
+		t.Errorf("wrong storage check: %+v", c)
+	}
+
+	// storage without database
+	db.Store("connection refused")
+	st, h = requestHealth(t, s, "/readyz")
+	if st != http.StatusServiceUnavailable {
+		t.Error("wrong status:", st)
+	}
+	if c := h.Checks["storage"]; c.Error != "database: connection refused" {
+		t.Errorf("wrong storage check: %+v", c)
+	}
+
+	// NATS is closed
+	s.Conn.Close()
+	if st, h = requestHealth(t, s, "/readyz"); st != 503 {
+		t.Error("wrong status:", st)
+	}
+	if c := h.Checks["nats"]; c.Status != StatusUnavailable {
+		t.Errorf("wrong NATS check: %+v", c)
+	}
+
+}
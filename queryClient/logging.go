@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package queryClient
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/logrusorgru/news_micro_storage_system/logging"
+)
+
+const maxRequestIDLen = 128 // longer IDs are replaced
+
+// validRequestID reports whether the id can be used as is, it's
+// passed through NATS headers and must not break them
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logRequests middleware assigns request ID and logs requests. The ID
+// is taken from the X-Request-ID header or generated, it's sent back
+// in the X-Request-ID response header and to the storage in NATS
+// message headers.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id = r.Header.Get(logging.RequestIDHeader)
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		r = r.WithContext(logging.WithRequestID(r.Context(), id))
+
+		var (
+			ww    = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start = time.Now()
+		)
+		next.ServeHTTP(ww, r)
+
+		var status = ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logging.Logger(r.Context()).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration_ms", float64(time.Since(start))/float64(time.Millisecond),
+			"remote", r.RemoteAddr,
+		)
+	})
+}
@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package queryClient
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"github.com/logrusorgru/news_micro_storage_system/logging"
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+func Test_validRequestID(t *testing.T) {
+	// validRequestID(id string) bool
+
+	for id, valid := range map[string]bool{
+		"":                                     false,
+		"4bf92f3577b34da6a3ce929d0e0e4736":     true,
+		"req-1_2.3:4":                          true,
+		"with space":                           false,
+		"new\r\nline":                          false,
+		strings.Repeat("x", maxRequestIDLen):   true,
+		strings.Repeat("x", maxRequestIDLen+1): false,
+	} {
+		if validRequestID(id) != valid {
+			t.Errorf("%q: expected %t", id, valid)
+		}
+	}
+
+}
+
+func TestServer_requestID(t *testing.T) {
+
+	var conf = testConf
+	conf.Subject = testConf.Subject + "_request_id"
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the fake storage handler reports request IDs
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	var ids = make(chan string, 1)
+	_, err = nc.Subscribe(conf.Subject, func(req *nats.Msg) {
+		ids <- req.Header.Get(logging.RequestIDHeader)
+		val, _ := proto.Marshal(&msg.Response{Item: &msg.NewsItem{ID: 1}})
+		req.Respond(val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var get = func(id string) (rsp, storage string) {
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest("GET", "/news/1", nil)
+		)
+		if id != "" {
+			r.Header.Set(logging.RequestIDHeader, id)
+		}
+		s.Server.Handler.ServeHTTP(w, r)
+		if w.Code != 200 {
+			t.Fatal("wrong status:", w.Code)
+		}
+		return w.Header().Get(logging.RequestIDHeader), <-ids
+	}
+
+	// given
+	if rsp, storage := get("req-1"); rsp != "req-1" || storage != "req-1" {
+		t.Errorf("wrong request IDs: %q, %q", rsp, storage)
+	}
+
+	// generated
+	for _, id := range []string{"", "bad id"} {
+		rsp, storage := get(id)
+		if !validRequestID(rsp) || rsp == id || storage != rsp {
+			t.Errorf("wrong request IDs: %q, %q", rsp, storage)
+		}
+	}
+
+}
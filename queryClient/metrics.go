@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package queryClient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "query_client"
+
+// metrics of a Server, every Server has its own registry
+type metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec   // route, method, status
+	httpDuration *prometheus.HistogramVec // route, method
+	natsDuration *prometheus.HistogramVec // subject
+	natsErrors   *prometheus.CounterVec   // subject, error
+}
+
+func newMetrics() (m *metrics) {
+	m = new(metrics)
+	m.registry = prometheus.NewRegistry()
+	m.httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	m.httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	m.natsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_request_duration_seconds",
+		Help:      "NATS request latency by subject.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"subject"})
+	m.natsErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "nats_request_errors_total",
+		Help:      "Failed NATS requests by subject and error.",
+	}, []string{"subject", "error"})
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.natsDuration,
+		m.natsErrors,
+	)
+	return
+}
+
+// handler of the /metrics
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Register additional metrics collectors, e.g. of an in-process
+// storage, served by the /metrics of the Server.
+func (s *Server) Register(cs ...prometheus.Collector) (err error) {
+	for _, c := range cs {
+		if err = s.metrics.registry.Register(c); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// methodLabel returns the method for known HTTP methods and "other"
+// for the rest, a client can send any method, keep cardinality low
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete,
+		http.MethodHead, http.MethodOptions, http.MethodPatch:
+		return method
+	}
+	return "other"
+}
+
+// middleware observes HTTP requests by route pattern
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			ww    = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start = time.Now()
+		)
+		next.ServeHTTP(ww, r)
+
+		var route = "unknown" // not found, keep cardinality low
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		var status = ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		var method = methodLabel(r.Method)
+		m.httpRequests.WithLabelValues(route, method,
+			strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(route, method).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeNATS request result
+func (m *metrics) observeNATS(subject string, start time.Time, err error) {
+	m.natsDuration.WithLabelValues(subject).
+		Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+	var kind = "other"
+	switch {
+	case errors.Is(err, nats.ErrTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		kind = "timeout"
+	case errors.Is(err, nats.ErrNoResponders):
+		kind = "no_responders"
+	}
+	m.natsErrors.WithLabelValues(subject, kind).Inc()
+}
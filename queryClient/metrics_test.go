@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package queryClient
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServer_metrics(t *testing.T) {
+
+	var conf = testConf
+	conf.Subject = testConf.Subject + "_metrics" // no responders
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var serve = func(method, path string) *httptest.ResponseRecorder {
+		var rec = httptest.NewRecorder()
+		s.Server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	serve("GET", "/news/1")
+	serve("GET", "/no/such/path")
+	serve("FOO1", "/news/1")
+	serve("FOO2", "/news/1")
+
+	var rec = serve("GET", "/metrics")
+	if rec.Code != 200 {
+		t.Fatal("wrong status:", rec.Code)
+	}
+
+	var body = rec.Body.String()
+	for _, want := range []string{
+		`query_client_http_requests_total{method="GET",route="/news/{id}",status="503"} 1`,
+		`query_client_http_requests_total{method="GET",route="unknown",status="404"} 1`,
+		`query_client_nats_request_duration_seconds_count{subject="` +
+			conf.Subject + `"} 1`,
+		`query_client_nats_request_errors_total{error="no_responders",subject="` +
+			conf.Subject + `"} 1`,
+		`query_client_http_requests_total{method="other",route="unknown",status="405"} 2`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Error("missing metric:", want)
+		}
+	}
+	if strings.Contains(body, "FOO") {
+		t.Error("unknown method in labels")
+	}
+
+}
+
+func TestServer_metricsListen(t *testing.T) {
+
+	var conf = testConf
+	conf.MetricsListen = "127.0.0.1:0"
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Metrics.Addr != conf.MetricsListen || s.Metrics.Handler == nil {
+		t.Error("metrics server not configured")
+	}
+
+	var rec = httptest.NewRecorder()
+	s.Server.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 404 {
+		t.Error("/metrics is served by the main server:", rec.Code)
+	}
+
+}
+
+func TestServer_Register(t *testing.T) {
+	// Register(cs ...prometheus.Collector) (err error)
+
+	var s = NewServerTransport(&testConf, nil)
+	var c = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "test_registered_total",
+		Help: "Test counter.",
+	})
+	c.Inc()
+	if err := s.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(c); err == nil {
+		t.Error("missing error: registered twice")
+	}
+
+	var rec = httptest.NewRecorder()
+	s.Server.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "test_registered_total 1") {
+		t.Error("missing registered metric")
+	}
+
+}
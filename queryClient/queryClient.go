@@ -26,22 +26,31 @@
 package queryClient
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	"github.com/gogo/protobuf/proto"
 
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/logrusorgru/news_micro_storage_system/client"
+	"github.com/logrusorgru/news_micro_storage_system/config"
+	"github.com/logrusorgru/news_micro_storage_system/logging"
 	"github.com/logrusorgru/news_micro_storage_system/msg"
+	"github.com/logrusorgru/news_micro_storage_system/natsconf"
+	"github.com/logrusorgru/news_micro_storage_system/tracing"
 )
 
 // defautls
@@ -50,6 +59,19 @@ const (
 	Timeout = 1 * time.Second
 	NATSURL = nats.DefaultURL
 	Subject = msg.Name
+
+	ShutdownTimeout = 10 * time.Second // graceful shutdown timeout
+	ReadyTimeout    = 1 * time.Second  // storage ping timeout of /readyz
+
+	Retries   = client.Retries   // retries of failed storage requests
+	RetryWait = client.RetryWait // pause between retries
+
+	ListLimit    = 20  // default items per page
+	MaxListLimit = 100 // max items per page
+	MaxBatchSize = 100 // max items per batch request
+
+	// EnvPrefix of environment variables of the config
+	EnvPrefix = "NEWS_QUERY_CLIENT_"
 )
 
 // A Config represents all storage configurations
@@ -60,10 +82,29 @@ type Config struct {
 	Addr    string        // address and port to listen on
 	Timeout time.Duration // request timeout
 
+	ShutdownTimeout time.Duration // graceful shutdown timeout
+	ReadyTimeout    time.Duration // storage ping timeout of /readyz
+
+	MetricsListen string // separate address of the /metrics, optional
+
+	Log   logging.Config // structured logging
+	Trace tracing.Config // OpenTelemetry tracing
+
 	// NATS
 
 	NATSURL string // nats url
 	Subject string // nats subject name
+
+	NATS natsconf.Config // NATS authentication and TLS
+
+	Retries   int           // retries of failed storage requests
+	RetryWait time.Duration // pause between retries
+
+	// Limits
+
+	ListLimit    int64 // default items per page
+	MaxListLimit int64 // max items per page
+	MaxBatchSize int   // max items per batch request
 }
 
 // NewConfig with defaults
@@ -71,8 +112,18 @@ func NewConfig() (c *Config) {
 	c = new(Config)
 	c.Addr = Addr
 	c.Timeout = Timeout
+	c.ShutdownTimeout = ShutdownTimeout
+	c.ReadyTimeout = ReadyTimeout
 	c.NATSURL = NATSURL
 	c.Subject = Subject
+	c.Retries = Retries
+	c.RetryWait = RetryWait
+	c.ListLimit = ListLimit
+	c.MaxListLimit = MaxListLimit
+	c.MaxBatchSize = MaxBatchSize
+	c.NATS = *natsconf.NewConfig()
+	c.Log = *logging.NewConfig()
+	c.Trace = *tracing.NewConfig()
 	return
 }
 
@@ -86,45 +137,162 @@ func NewConfig() (c *Config) {
 // The prefix argument used to prefix all the flags with the
 // given prefix. Use "prefix-" or something like that.
 func (c *Config) FromFlags(fset *flag.FlagSet, prefix string) {
-	flag.StringVar(&c.Addr,
+	fset.StringVar(&c.Addr,
 		prefix+"addr",
 		c.Addr,
 		"listening address with port")
-	flag.DurationVar(&c.Timeout,
+	fset.DurationVar(&c.Timeout,
 		prefix+"timeout",
 		c.Timeout,
 		"HTTP request timeout")
-	flag.StringVar(&c.NATSURL,
+	fset.DurationVar(&c.ShutdownTimeout,
+		prefix+"shutdown-timeout",
+		c.ShutdownTimeout,
+		"graceful shutdown timeout, max time to finish active requests")
+	fset.DurationVar(&c.ReadyTimeout,
+		prefix+"ready-timeout",
+		c.ReadyTimeout,
+		"storage service ping timeout of the /readyz endpoint")
+	fset.StringVar(&c.MetricsListen,
+		prefix+"metrics-listen",
+		c.MetricsListen,
+		"separate address and port of the /metrics endpoint, "+
+			"empty to serve it on the main address")
+	c.Log.FromFlags(fset, prefix)
+	c.Trace.FromFlags(fset, prefix)
+	fset.StringVar(&c.NATSURL,
 		prefix+"nats-url",
 		c.NATSURL,
 		"NATS server's url")
-	flag.StringVar(&c.Subject,
+	fset.StringVar(&c.Subject,
 		prefix+"nats-subject",
 		c.Subject,
 		"NATS subject's name")
+	c.NATS.FromFlags(fset, prefix)
+	fset.IntVar(&c.Retries,
+		prefix+"retries",
+		c.Retries,
+		"retries of undelivered storage requests and of reads "+
+			"rejected by unavailable or overloaded storage")
+	fset.DurationVar(&c.RetryWait,
+		prefix+"retry-wait",
+		c.RetryWait,
+		"pause between retries")
+	fset.Int64Var(&c.ListLimit,
+		prefix+"list-limit",
+		c.ListLimit,
+		"default items per page")
+	fset.Int64Var(&c.MaxListLimit,
+		prefix+"max-list-limit",
+		c.MaxListLimit,
+		"max items per page")
+	fset.IntVar(&c.MaxBatchSize,
+		prefix+"max-batch-size",
+		c.MaxBatchSize,
+		"max items per batch request")
+}
+
+// Validate values of the Config.
+func (c *Config) Validate() (err error) {
+	switch {
+	case !config.ValidAddr(c.Addr):
+		return fmt.Errorf("invalid listen address: %q", c.Addr)
+	case c.Timeout <= 0:
+		return fmt.Errorf("invalid timeout: %s", c.Timeout)
+	case c.ShutdownTimeout < 0:
+		return fmt.Errorf("negative shutdown timeout: %s", c.ShutdownTimeout)
+	case c.ReadyTimeout <= 0:
+		return fmt.Errorf("invalid ready timeout: %s", c.ReadyTimeout)
+	case c.MetricsListen != "" && !config.ValidAddr(c.MetricsListen):
+		return fmt.Errorf("invalid metrics listen address: %q",
+			c.MetricsListen)
+	case c.NATSURL == "":
+		return errors.New("empty NATS url")
+	case !config.ValidSubject(c.Subject):
+		return fmt.Errorf("invalid NATS subject: %q", c.Subject)
+	case c.Retries < 0:
+		return fmt.Errorf("negative retries: %d", c.Retries)
+	case c.RetryWait < 0:
+		return fmt.Errorf("negative retry wait: %s", c.RetryWait)
+	case c.MaxListLimit <= 0:
+		return fmt.Errorf("invalid max list limit: %d", c.MaxListLimit)
+	case c.ListLimit <= 0 || c.ListLimit > c.MaxListLimit:
+		return fmt.Errorf("invalid list limit: %d, should be in 1-%d",
+			c.ListLimit, c.MaxListLimit)
+	case c.MaxBatchSize <= 0:
+		return fmt.Errorf("invalid max batch size: %d", c.MaxBatchSize)
+	}
+	if err = c.NATS.Validate(); err != nil {
+		return
+	}
+	return c.Trace.Validate()
+}
+
+// tracer of the queryClient, it's looked up for every span, thus spans
+// go to current global tracer provider
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/logrusorgru/news_micro_storage_system/queryClient")
 }
 
 // A Server represents HTTP server
 type Server struct {
-	Conf   *Config     // reference to Config
-	Server http.Server // HTTP Server
-	Conn   *nats.Conn  // NATS connection
+	Conf    *Config     // reference to Config
+	Server  http.Server // HTTP Server
+	Metrics http.Server // metrics HTTP Server, if conf.MetricsListen set
+	Conn    *nats.Conn  // NATS connection, nil for other transport
+
+	// Client of storage services using the Conn or
+	// other transport, e.g. an in-process storage
+	Client *client.Client
+
+	metrics *metrics
 }
 
+// A Transport of requests to storage services, see the client.Transport.
+type Transport = client.Transport
+
 // NewServer connects to NATS server and returns HTTP server.
 // Start it using
 //
 //    srv.Server.ListenAndServe()
 //
+// and stop it using the Shutdown or the Close. If the conf.MetricsListen
+// is set, then start the srv.Metrics too.
+//
 func NewServer(conf *Config) (srv *Server, err error) {
+	// setup NATS
+	var opts []nats.Option
+	if opts, err = conf.NATS.Options(); err != nil {
+		return
+	}
+	opts = append(opts, natsconf.Handlers(nil)...)
+	var conn *nats.Conn
+	conn, err = nats.Connect(conf.NATSURL,
+		append(opts, nats.DrainTimeout(conf.ShutdownTimeout))...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("conencting NATS: %v", err)
+	}
+	srv = NewServerTransport(conf, conn)
+	srv.Conn = conn
+	return
+}
+
+// NewServerTransport returns HTTP server that uses given transport
+// instead of NATS connection, e.g. an in-process storage. The
+// conf.NATS and the conf.NATSURL are not used. The Shutdown and the
+// Close don't close the transport.
+func NewServerTransport(conf *Config, t Transport) (srv *Server) {
 	srv = new(Server)
 	srv.Conf = conf
 	srv.Server.Addr = conf.Addr
+	srv.metrics = newMetrics()
 
-	// setup NATS
-	if srv.Conn, err = nats.Connect(conf.NATSURL); err != nil {
-		return nil, fmt.Errorf("conencting NATS: %v", err)
-	}
+	srv.Client = client.New(t, conf.Subject)
+	srv.Client.Timeout = conf.Timeout
+	srv.Client.Retries = conf.Retries
+	srv.Client.RetryWait = conf.RetryWait
+	srv.Client.Observe = srv.metrics.observeNATS
 
 	// setup routes
 	srv.setupRoutes()
@@ -133,14 +301,31 @@ func NewServer(conf *Config) (srv *Server, err error) {
 
 func (s *Server) setupRoutes() {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)                  // request logs
-	r.Use(middleware.Timeout(s.Conf.Timeout)) // request timeout
-	r.Get("/news/{id}", s.getNews)
+	r.Use(s.metrics.middleware)
+	if s.Conf.MetricsListen == "" {
+		r.Method("GET", "/metrics", s.metrics.handler())
+	} else {
+		s.Metrics.Addr = s.Conf.MetricsListen
+		s.Metrics.Handler = s.metrics.handler()
+	}
+	// probes, without logs and with own timeout
+	r.Get("/healthz", s.healthz)
+	r.Get("/readyz", s.readyz)
+	r.Group(func(r chi.Router) {
+		r.Use(logRequests)                        // request IDs and logs
+		r.Use(middleware.Timeout(s.Conf.Timeout)) // request timeout
+		r.Get("/news", s.listNews)
+		r.Post("/news", s.postNews)
+		r.Post("/news:batchGet", s.batchGetNews)
+		r.Get("/news/{id}", s.getNews)
+		r.Put("/news/{id}", s.putNews)
+		r.Delete("/news/{id}", s.deleteNews)
+	})
 	s.Server.Handler = r
 }
 
-// GET /news/{id}
-func (s *Server) getNews(w http.ResponseWriter, r *http.Request) {
+// newsID from URL, it writes 400 error if the identifier is invalid
+func newsID(w http.ResponseWriter, r *http.Request) (id int64, ok bool) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		http.Error(w, "invalid news identifier: "+err.Error(), http.StatusBadRequest)
@@ -150,46 +335,353 @@ func (s *Server) getNews(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "news identifier can't be negative", http.StatusBadRequest)
 		return
 	}
-	var mid msg.ID
-	mid.ID = id
-	val, err := proto.Marshal(&mid)
+	return id, true
+}
+
+// newsItem from JSON body, it writes 400 error if the body is invalid
+func newsItem(w http.ResponseWriter, r *http.Request) (ni *msg.NewsItem, ok bool) {
+	ni = new(msg.NewsItem)
+	if err := json.NewDecoder(r.Body).Decode(ni); err != nil {
+		http.Error(w, "invalid news item: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	return ni, true
+}
+
+// storageError writes error of a failed storage request. It writes
+// 500, 503 or 504 error if the request is not answered.
+func storageError(w http.ResponseWriter, r *http.Request, err error) {
+	var ce *client.Error
+	if errors.As(err, &ce) {
+		responseError(w, r, ce.Code, ce.Detail)
+		return
+	}
+	logging.Logger(r.Context()).Warn("NATS request failed", "error", err)
+	var status = http.StatusInternalServerError
+	switch {
+	case errors.Is(err, nats.ErrTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, nats.ErrNoResponders):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, statusText(status), status)
+}
+
+// statusText is lower cased http.StatusText
+func statusText(status int) string {
+	return strings.ToLower(http.StatusText(status))
+}
+
+// codeStatus returns HTTP status of given msg.Code.
+func codeStatus(code msg.Code) int {
+	switch code {
+	case msg.Code_OK:
+		return http.StatusOK
+	case msg.Code_NOT_FOUND:
+		return http.StatusNotFound
+	case msg.Code_INVALID_ARGUMENT:
+		return http.StatusBadRequest
+	case msg.Code_ALREADY_EXISTS:
+		return http.StatusConflict
+	case msg.Code_UNAVAILABLE,
+		msg.Code_RESOURCE_EXHAUSTED,
+		msg.Code_CANCELED:
+		return http.StatusServiceUnavailable
+	case msg.Code_DEADLINE_EXCEEDED:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError // INTERNAL or unknown
+}
+
+// responseError writes error of given not OK code. The detail
+// is shown for 400 and 409 errors, and logged for 5xx.
+func responseError(
+	w http.ResponseWriter,
+	r *http.Request,
+	code msg.Code,
+	detail string,
+) {
+	var status = codeStatus(code)
+	switch {
+	case status == http.StatusBadRequest, status == http.StatusConflict:
+		http.Error(w, statusText(status)+": "+detail, status)
+		return
+	case status >= 500:
+		logging.Logger(r.Context()).Error("storage error",
+			"code", code.String(), "detail", detail)
+	}
+	http.Error(w, statusText(status), status)
+}
+
+// writeJSON with given status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, val interface{}) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(val); err != nil {
+		logging.Logger(r.Context()).Warn("writing response", "error", err)
+	}
+}
+
+// GET /news/{id}
+func (s *Server) getNews(w http.ResponseWriter, r *http.Request) {
+	var ctx, span = tracer().Start(tracing.ExtractHTTP(r), "GET /news/{id}",
+		trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	id, ok := newsID(w, r)
+	if !ok {
+		span.SetStatus(codes.Error, "invalid id")
+		return
+	}
+	span.SetAttributes(attribute.Int64("news.id", id))
+	ni, err := s.Client.Get(ctx, id)
 	if err != nil {
-		panic("encoding error: " + err.Error()) // must not happen
+		span.SetStatus(codes.Error, "request failed")
+		storageError(w, r, err)
+		return
 	}
-	// NATS request
-	resp, err := s.Conn.RequestWithContext(r.Context(), s.Conf.Subject, val)
+	// found
+	writeJSON(w, r, http.StatusOK, ni)
+}
+
+// A NewsList represents JSON response of the GET /news. The Next
+// is cursor for the next page, it's omitted on the last page.
+type NewsList struct {
+	Items []*msg.NewsItem `json:"items"`
+	Next  int64           `json:"next,omitempty"`
+}
+
+// queryInt64 parses optional non-negative integer query parameter,
+// it writes 400 error if the parameter is invalid
+func queryInt64(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	def int64,
+) (
+	val int64,
+	ok bool,
+) {
+	var str = r.URL.Query().Get(name)
+	if str == "" {
+		return def, true
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
 	if err != nil {
-		// 500 error
-		log.Print("[NATS] request error: ", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		http.Error(w, "invalid "+name+": "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	//
-	var mrsp msg.Response
-	if err = proto.Unmarshal(resp.Data, &mrsp); err != nil {
-		panic("decoding error: " + err.Error())
+	if val < 0 {
+		http.Error(w, name+" can't be negative", http.StatusBadRequest)
+		return
 	}
-	if mrsp.Error != "" {
-		// 404
-		if mrsp.Error == sql.ErrNoRows.Error() {
-			http.Error(w, "not found", http.StatusNotFound)
+	return val, true
+}
+
+// GET /news?after={id}&limit={n}
+// GET /news?ids={id},{id},...
+func (s *Server) listNews(w http.ResponseWriter, r *http.Request) {
+	if ids, ok := r.URL.Query()["ids"]; ok {
+		s.batchNewsQuery(w, r, strings.Join(ids, ","))
+		return
+	}
+	var after, limit int64
+	var ok bool
+	if after, ok = queryInt64(w, r, "after", 0); !ok {
+		return
+	}
+	if limit, ok = queryInt64(w, r, "limit", s.Conf.ListLimit); !ok {
+		return
+	}
+	if limit == 0 {
+		limit = s.Conf.ListLimit
+	} else if limit > s.Conf.MaxListLimit {
+		limit = s.Conf.MaxListLimit
+	}
+	var nl NewsList
+	var err error
+	if nl.Items, nl.Next, err = s.Client.List(r.Context(), after, limit); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if nl.Items == nil {
+		nl.Items = []*msg.NewsItem{} // [] instead of null
+	}
+	writeJSON(w, r, http.StatusOK, &nl)
+}
+
+// A NewsBatch represents JSON response of batch requests. The Errors
+// contains identifiers of missing or failed items.
+type NewsBatch struct {
+	Items  []*msg.NewsItem `json:"items"`
+	Errors []NewsError     `json:"errors,omitempty"`
+}
+
+// A NewsError represents error of one item of a batch.
+type NewsError struct {
+	ID    int64  `json:"id"`
+	Error string `json:"error"`
+}
+
+// A BatchGet represents JSON body of the POST /news:batchGet.
+type BatchGet struct {
+	IDs []int64 `json:"ids"`
+}
+
+// GET /news?ids={id},{id},...
+func (s *Server) batchNewsQuery(w http.ResponseWriter, r *http.Request, list string) {
+	var ids []int64
+	for _, str := range strings.Split(list, ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid news identifier: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		// 500 error
-		log.Print("[NATS] request error: ", mrsp.Error)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		ids = append(ids, id)
+	}
+	s.batchNews(w, r, ids)
+}
+
+// POST /news:batchGet
+func (s *Server) batchGetNews(w http.ResponseWriter, r *http.Request) {
+	var bg BatchGet
+	if err := json.NewDecoder(r.Body).Decode(&bg); err != nil {
+		http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	// found
-	w.Header().Add("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(mrsp.Item); err != nil {
-		log.Print("[HTTP] writing response: ", err)
+	s.batchNews(w, r, bg.IDs)
+}
+
+// batchNews requests and writes news items by given identifiers
+func (s *Server) batchNews(w http.ResponseWriter, r *http.Request, ids []int64) {
+	if len(ids) == 0 {
+		http.Error(w, "missing news identifiers", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > s.Conf.MaxBatchSize {
+		http.Error(w, fmt.Sprintf("too many news identifiers, max %d",
+			s.Conf.MaxBatchSize), http.StatusBadRequest)
+		return
+	}
+	for _, id := range ids {
+		if id < 0 {
+			http.Error(w, "news identifier can't be negative", http.StatusBadRequest)
+			return
+		}
+	}
+	items, errs, err := s.Client.Batch(r.Context(), ids)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	var nb NewsBatch
+	nb.Items = items
+	if nb.Items == nil {
+		nb.Items = []*msg.NewsItem{} // [] instead of null
+	}
+	for _, be := range errs {
+		var status = codeStatus(be.Code)
+		if status >= 500 {
+			logging.Logger(r.Context()).Error("storage batch item error",
+				"id", be.ID, "code", be.Code.String(), "detail", be.Error)
+		}
+		var ne = NewsError{ID: be.ID, Error: statusText(status)}
+		nb.Errors = append(nb.Errors, ne)
 	}
+	writeJSON(w, r, http.StatusOK, &nb)
 }
 
-// Close the Server.
+// POST /news
+func (s *Server) postNews(w http.ResponseWriter, r *http.Request) {
+	ni, ok := newsItem(w, r)
+	if !ok {
+		return
+	}
+	ni, err := s.Client.Insert(r.Context(), ni)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	// created
+	w.Header().Set("Location", fmt.Sprintf("/news/%d", ni.GetID()))
+	writeJSON(w, r, http.StatusCreated, ni)
+}
+
+// PUT /news/{id}
+func (s *Server) putNews(w http.ResponseWriter, r *http.Request) {
+	id, ok := newsID(w, r)
+	if !ok {
+		return
+	}
+	ni, ok := newsItem(w, r)
+	if !ok {
+		return
+	}
+	ni.ID = id // the ID from URL
+	if err := s.Client.Update(r.Context(), ni); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // updated
+}
+
+// DELETE /news/{id}
+func (s *Server) deleteNews(w http.ResponseWriter, r *http.Request) {
+	id, ok := newsID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Client.Delete(r.Context(), id); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // deleted
+}
+
+// Shutdown the Server gracefully. It stops accepting new connections,
+// waits for active requests and drains NATS connection, if any. All
+// this takes conf.ShutdownTimeout at most. The ListenAndServe returns
+// http.ErrServerClosed immediately after the Shutdown call.
+func (s *Server) Shutdown() (err error) {
+	var ctx, cancel = context.WithTimeout(context.Background(),
+		s.Conf.ShutdownTimeout)
+	defer cancel()
+
+	err = s.Server.Shutdown(ctx)
+	if merr := s.Metrics.Shutdown(ctx); merr != nil && err == nil {
+		err = merr
+	}
+
+	if s.Conn == nil {
+		return
+	}
+	if derr := s.Conn.Drain(); derr != nil {
+		s.Conn.Close()
+		if err == nil {
+			err = derr
+		}
+		return
+	}
+	for !s.Conn.IsClosed() && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Conn.Close()
+	return
+}
+
+// Close the Server immediately.
 func (s *Server) Close() (err error) {
 	err = s.Server.Close()
-	s.Conn.Close()
+	if merr := s.Metrics.Close(); merr != nil && err == nil {
+		err = merr
+	}
+	if s.Conn != nil {
+		s.Conn.Close()
+	}
 	return
 }
@@ -26,36 +26,96 @@
 package queryClient
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/logrusorgru/news_micro_storage_system/logging"
 	"github.com/logrusorgru/news_micro_storage_system/msg"
+	"github.com/logrusorgru/news_micro_storage_system/natsconf"
+	"github.com/logrusorgru/news_micro_storage_system/natstest"
+	"github.com/logrusorgru/news_micro_storage_system/tracing"
+	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 var testConf Config
 
 func init() {
 
-	testConf.Addr = "127.0.0.1:3000"
+	testConf.Addr = "" // free port
 	testConf.Timeout = 1 * time.Second
-	testConf.NATSURL = nats.DefaultURL
+	testConf.ShutdownTimeout = 1 * time.Second
+	testConf.ReadyTimeout = 1 * time.Second
+	testConf.NATSURL = "" // embedded server
 	testConf.Subject = "test_news_items"
+	testConf.ListLimit = ListLimit
+	testConf.MaxListLimit = MaxListLimit
+	testConf.MaxBatchSize = MaxBatchSize
+	testConf.NATS = *natsconf.NewConfig()
 
 	testConf.FromFlags(flag.CommandLine, "test-")
+}
+
+// freeAddr returns address of a free port of the localhost
+func freeAddr() (addr string, err error) {
+	var l net.Listener
+	if l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return
+	}
+	addr = l.Addr().String()
+	err = l.Close()
+	return
+}
+
+// TestMain starts embedded NATS server if the -test-nats-url is not
+// set and listens on a free port if the -test-addr is not set, thus
+// the tests need no external services.
+func TestMain(m *testing.M) {
 	flag.Parse()
 
 	if !testing.Verbose() {
 		// TODO (kostayrin): discard chi logs if the tests are not verbose
 	}
+
+	var (
+		ns  *server.Server
+		err error
+	)
+	if testConf.Addr == "" {
+		if testConf.Addr, err = freeAddr(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if testConf.NATSURL == "" {
+		if ns, err = natstest.NewServer(nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		testConf.NATSURL = ns.ClientURL()
+	}
+	var code = m.Run()
+	if ns != nil {
+		ns.Shutdown()
+	}
+	os.Exit(code)
 }
 
 func TestNewConfig(t *testing.T) {
@@ -64,8 +124,15 @@ func TestNewConfig(t *testing.T) {
 	conf := NewConfig()
 	isDefault := (conf.Addr == Addr) &&
 		(conf.Timeout == Timeout) &&
+		(conf.ShutdownTimeout == ShutdownTimeout) &&
+		(conf.ReadyTimeout == ReadyTimeout) &&
 		(conf.NATSURL == NATSURL) &&
-		(conf.Subject == Subject)
+		(conf.Subject == Subject) &&
+		(conf.ListLimit == ListLimit) &&
+		(conf.NATS == *natsconf.NewConfig()) &&
+		(conf.Log == *logging.NewConfig()) &&
+		(conf.Trace == *tracing.NewConfig()) &&
+		(conf.MaxListLimit == MaxListLimit)
 
 	if !isDefault {
 		t.Error("NewConfig contains non-default values")
@@ -80,17 +147,24 @@ func TestConfig_FromFlags(t *testing.T) {
 	var conf = NewConfig()
 
 	conf.FromFlags(fset, "")
-	fset.Parse([]string{
-		"addr", "addr",
-		"timeout", "500ms",
-		"nats-url", "url",
-		"nats-subject", "subj",
+	err := fset.Parse([]string{
+		"-addr", "addr",
+		"-timeout", "500ms",
+		"-nats-url", "url",
+		"-nats-subject", "subj",
+		"-nats-user", "nats-user",
+		"-trace-exporter", "stdout",
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	isSet := (conf.Addr != "addr") &&
-		(conf.Timeout != 500*time.Millisecond) &&
-		(conf.NATSURL != "url") &&
-		(conf.Subject != "subj")
+	isSet := (conf.Addr == "addr") &&
+		(conf.Timeout == 500*time.Millisecond) &&
+		(conf.NATSURL == "url") &&
+		(conf.Subject == "subj") &&
+		(conf.NATS.User == "nats-user") &&
+		(conf.Trace.Exporter == "stdout")
 
 	if !isSet {
 		t.Error("incorrect argumetns parsing")
@@ -98,6 +172,49 @@ func TestConfig_FromFlags(t *testing.T) {
 
 }
 
+func TestConfig_Validate(t *testing.T) {
+	// Validate() (err error)
+
+	if err := NewConfig().Validate(); err != nil {
+		t.Error(err)
+	}
+
+	for name, set := range map[string]func(c *Config){
+		"addr":             func(c *Config) { c.Addr = "localhost" },
+		"port":             func(c *Config) { c.Addr = ":70000" },
+		"timeout":          func(c *Config) { c.Timeout = 0 },
+		"shutdown timeout": func(c *Config) { c.ShutdownTimeout = -1 },
+		"ready timeout":    func(c *Config) { c.ReadyTimeout = 0 },
+		"metrics":          func(c *Config) { c.MetricsListen = "x" },
+		"nats url":         func(c *Config) { c.NATSURL = "" },
+		"subject":          func(c *Config) { c.Subject = "" },
+		"retries":          func(c *Config) { c.Retries = -1 },
+		"retry wait":       func(c *Config) { c.RetryWait = -1 },
+		"list limit":       func(c *Config) { c.ListLimit = 0 },
+		"big list limit":   func(c *Config) { c.ListLimit = MaxListLimit + 1 },
+		"max list limit":   func(c *Config) { c.MaxListLimit = 0 },
+		"batch size":       func(c *Config) { c.MaxBatchSize = 0 },
+		"nats auth":        func(c *Config) { c.NATS.TLSKey = "key" },
+		"trace":            func(c *Config) { c.Trace.SampleRatio = 2 },
+	} {
+		var conf = NewConfig()
+		set(conf)
+		if err := conf.Validate(); err == nil {
+			t.Error("missing error:", name)
+		}
+	}
+
+}
+
+// identifiers of fake handlers that respond with errors
+var testCodes = map[int64]msg.Code{
+	4: msg.Code_NOT_FOUND,
+	5: msg.Code_INTERNAL,
+	6: msg.Code_UNAVAILABLE,
+	7: msg.Code_DEADLINE_EXCEEDED,
+	8: msg.Code_INVALID_ARGUMENT,
+}
+
 func natsHandler(t *testing.T, conf *Config) (nc *nats.Conn, subs *nats.Subscription) {
 	var err error
 	if nc, err = nats.Connect(conf.NATSURL); err != nil {
@@ -109,10 +226,8 @@ func natsHandler(t *testing.T, conf *Config) (nc *nats.Conn, subs *nats.Subscrip
 			t.Fatal(err)
 		}
 		var mrsp msg.Response
-		if mid.ID == 4 {
-			mrsp.Error = sql.ErrNoRows.Error()
-		} else if mid.ID == 5 {
-			mrsp.Error = "some error"
+		if code, ok := testCodes[mid.ID]; ok {
+			mrsp.Code, mrsp.Error = code, "some error"
 		} else {
 			mrsp.Item = &msg.NewsItem{
 				ID:     mid.ID,
@@ -131,9 +246,160 @@ func natsHandler(t *testing.T, conf *Config) (nc *nats.Conn, subs *nats.Subscrip
 	if err != nil {
 		t.Fatal(err)
 	}
+	if err = nc.Flush(); err != nil { // make sure the subscription is set
+		t.Fatal(err)
+	}
 	return
 }
 
+// fake insert, update and delete handlers, the subscriptions
+// are closed with the connection
+func natsModifyHandlers(t *testing.T, nc *nats.Conn, conf *Config) {
+	var respond = func(req *nats.Msg, mrsp *msg.Response) {
+		val, err := proto.Marshal(mrsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Respond(val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var byID = func(id int64, mrsp *msg.Response) {
+		if code, ok := testCodes[id]; ok {
+			mrsp.Code, mrsp.Error = code, "some error"
+		}
+	}
+	var err error
+	_, err = nc.Subscribe(conf.Subject+msg.InsertSuffix, func(req *nats.Msg) {
+		var ins msg.InsertRequest
+		if err := proto.Unmarshal(req.Data, &ins); err != nil {
+			t.Fatal(err)
+		}
+		var mrsp msg.Response
+		if ins.Item.Header == "error" {
+			mrsp.Code, mrsp.Error = msg.Code_INTERNAL, "some error"
+		} else {
+			mrsp.Item = ins.Item
+			mrsp.Item.ID = 10
+		}
+		respond(req, &mrsp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nc.Subscribe(conf.Subject+msg.UpdateSuffix, func(req *nats.Msg) {
+		var upd msg.UpdateRequest
+		if err := proto.Unmarshal(req.Data, &upd); err != nil {
+			t.Fatal(err)
+		}
+		var mrsp msg.Response
+		if byID(upd.Item.ID, &mrsp); mrsp.Error == "" {
+			mrsp.Item = upd.Item
+		}
+		respond(req, &mrsp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nc.Subscribe(conf.Subject+msg.DeleteSuffix, func(req *nats.Msg) {
+		var del msg.DeleteRequest
+		if err := proto.Unmarshal(req.Data, &del); err != nil {
+			t.Fatal(err)
+		}
+		var mrsp msg.Response
+		byID(del.ID, &mrsp)
+		respond(req, &mrsp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fake list handler, it has items from 1 to 50, the
+// subscription is closed with the connection
+func natsListHandler(t *testing.T, nc *nats.Conn, conf *Config) {
+	_, err := nc.Subscribe(conf.Subject+msg.ListSuffix, func(req *nats.Msg) {
+		var list msg.ListRequest
+		if err := proto.Unmarshal(req.Data, &list); err != nil {
+			t.Fatal(err)
+		}
+		var mrsp msg.ListResponse
+		for id := list.After + 1; id <= 50 && int64(len(mrsp.Items)) < list.Limit; id++ {
+			mrsp.Items = append(mrsp.Items, &msg.NewsItem{
+				ID:     id,
+				Header: fmt.Sprintf("head-%d", id),
+				Data:   fmt.Sprintf("data-%d", id),
+			})
+		}
+		if int64(len(mrsp.Items)) == list.Limit {
+			mrsp.Next = mrsp.Items[len(mrsp.Items)-1].ID
+		}
+		val, err := proto.Marshal(&mrsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Respond(val); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fake batch handler, it has items from 1 to 3, the item 5
+// fails, the subscription is closed with the connection
+func natsBatchHandler(t *testing.T, nc *nats.Conn, conf *Config) {
+	_, err := nc.Subscribe(conf.Subject+msg.BatchSuffix, func(req *nats.Msg) {
+		var batch msg.BatchRequest
+		if err := proto.Unmarshal(req.Data, &batch); err != nil {
+			t.Fatal(err)
+		}
+		var mrsp msg.BatchResponse
+		for _, id := range batch.IDs {
+			switch {
+			case id >= 1 && id <= 3:
+				mrsp.Items = append(mrsp.Items, &msg.NewsItem{
+					ID:     id,
+					Header: fmt.Sprintf("head-%d", id),
+					Data:   fmt.Sprintf("data-%d", id),
+				})
+			case id == 5:
+				mrsp.Errors = append(mrsp.Errors, &msg.BatchError{
+					ID:    id,
+					Error: "some error",
+					Code:  msg.Code_INTERNAL,
+				})
+			default:
+				mrsp.Errors = append(mrsp.Errors, &msg.BatchError{
+					ID:    id,
+					Error: "not found",
+					Code:  msg.Code_NOT_FOUND,
+				})
+			}
+		}
+		val, err := proto.Marshal(&mrsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Respond(val); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func request(t *testing.T, id int64, conf *Config) {
 	t.Log("request:", id)
 	resp, err := http.Get("http://" + testConf.Addr + fmt.Sprintf("/news/%d", id))
@@ -178,6 +444,274 @@ func requestError(t *testing.T, id string) (status int, body string) {
 	return resp.StatusCode, string(bb)
 }
 
+func requestMethod(
+	t *testing.T,
+	method string,
+	path string,
+	body string,
+) (
+	status int,
+	rbody string,
+	resp *http.Response,
+) {
+	t.Log("request: ", method, path)
+	req, err := http.NewRequest(method, "http://"+testConf.Addr+path,
+		strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bb, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(bb), resp
+}
+
+func TestNewServer_auth(t *testing.T) {
+	// NewServer(conf *Config) (srv *Server, err error)
+
+	var conf = testConf
+	conf.NATSURL = natstest.Run(t, &server.Options{
+		Username: "user",
+		Password: "pass",
+	})
+	conf.NATS.RetryOnFailedConnect = false // fail on start
+
+	if _, err := NewServer(&conf); err == nil {
+		t.Error("connected without credentials")
+	}
+
+	conf.NATS.User, conf.NATS.Password = "user", "pass"
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+}
+
+func TestServer_modify(t *testing.T) {
+
+	s, err := NewServer(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	go s.Server.ListenAndServe()
+
+	nc, subs := natsHandler(t, &testConf)
+	defer nc.Close()
+	defer subs.Unsubscribe()
+	natsModifyHandlers(t, nc, &testConf)
+
+	// create
+	st, body, resp := requestMethod(t, "POST", "/news",
+		`{"Header":"head-10","Data":"data-10"}`)
+	if st != 201 {
+		t.Error("wrong status:", st, body)
+	} else if loc := resp.Header.Get("Location"); loc != "/news/10" {
+		t.Errorf("wrong location: %q", loc)
+	} else {
+		var item msg.NewsItem
+		if err := json.Unmarshal([]byte(body), &item); err != nil {
+			t.Fatal(err)
+		}
+		if item.ID != 10 || item.Header != "head-10" || item.Data != "data-10" {
+			t.Error("wrong item:", item)
+		}
+	}
+
+	// create, invalid body
+	if st, body, _ := requestMethod(t, "POST", "/news", "ololo"); st != 400 {
+		t.Error("wrong status:", st)
+	} else if !strings.HasPrefix(body, "invalid news item: ") {
+		t.Errorf("wrong response body: %q", body)
+	}
+
+	// create, some error
+	if st, _, _ := requestMethod(t, "POST", "/news",
+		`{"Header":"error"}`); st != 500 {
+		t.Error("wrong status:", st)
+	}
+
+	// update, delete
+	for _, method := range []string{"PUT", "DELETE"} {
+		if st, body, _ := requestMethod(t, method, "/news/1",
+			`{"Header":"head-1","Data":"data-1"}`); st != 204 {
+			t.Error("wrong status:", method, st, body)
+		}
+		if st, body, _ := requestMethod(t, method, "/news/4", `{}`); st != 404 {
+			t.Error("wrong status:", method, st)
+		} else if body != "not found\n" {
+			t.Errorf("wrong response body: %q", body)
+		}
+		if st, _, _ := requestMethod(t, method, "/news/5", `{}`); st != 500 {
+			t.Error("wrong status:", method, st)
+		}
+		if st, _, _ := requestMethod(t, method, "/news/-1", `{}`); st != 400 {
+			t.Error("wrong status:", method, st)
+		}
+	}
+
+	// update, invalid body
+	if st, _, _ := requestMethod(t, "PUT", "/news/1", "ololo"); st != 400 {
+		t.Error("wrong status:", st)
+	}
+
+}
+
+func requestList(t *testing.T, query string) (nl NewsList) {
+	st, body, _ := requestMethod(t, "GET", "/news"+query, "")
+	if st != 200 {
+		t.Fatal("wrong status:", st, body)
+	}
+	if err := json.Unmarshal([]byte(body), &nl); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestServer_list(t *testing.T) {
+
+	var conf = testConf
+	conf.ListLimit = 20
+	conf.MaxListLimit = 30
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	go s.Server.ListenAndServe()
+
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	natsListHandler(t, nc, &conf)
+
+	// default limit
+	if nl := requestList(t, ""); len(nl.Items) != 20 || nl.Next != 20 {
+		t.Error("wrong first page:", len(nl.Items), nl.Next)
+	}
+
+	// capped limit
+	if nl := requestList(t, "?after=10&limit=1000"); len(nl.Items) != 30 ||
+		nl.Items[0].ID != 11 || nl.Next != 40 {
+		t.Error("wrong capped page:", len(nl.Items), nl.Next)
+	}
+
+	// last page
+	if nl := requestList(t, "?after=40&limit=20"); len(nl.Items) != 10 ||
+		nl.Next != 0 {
+		t.Error("wrong last page:", len(nl.Items), nl.Next)
+	}
+
+	// empty page
+	if st, body, _ := requestMethod(t, "GET", "/news?after=50", ""); st != 200 {
+		t.Error("wrong status:", st)
+	} else if body != "{\"items\":[]}\n" {
+		t.Errorf("wrong response body: %q", body)
+	}
+
+	// invalid
+	for _, query := range []string{"?after=x", "?limit=x", "?after=-1"} {
+		if st, _, _ := requestMethod(t, "GET", "/news"+query, ""); st != 400 {
+			t.Error("wrong status:", query, st)
+		}
+	}
+
+}
+
+func TestServer_batch(t *testing.T) {
+
+	var conf = testConf
+	conf.MaxBatchSize = 5
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	go s.Server.ListenAndServe()
+
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	natsBatchHandler(t, nc, &conf)
+
+	var check = func(method, path, body string) {
+		st, rbody, _ := requestMethod(t, method, path, body)
+		if st != 200 {
+			t.Fatal("wrong status:", st, rbody)
+		}
+		var nb NewsBatch
+		if err := json.Unmarshal([]byte(rbody), &nb); err != nil {
+			t.Fatal(err)
+		}
+		if len(nb.Items) != 2 || nb.Items[0].ID != 3 || nb.Items[1].ID != 1 {
+			t.Error("wrong items:", nb.Items)
+		}
+		var want = []NewsError{
+			{ID: 4, Error: "not found"},
+			{ID: 5, Error: "internal server error"},
+		}
+		if len(nb.Errors) != 2 || nb.Errors[0] != want[0] || nb.Errors[1] != want[1] {
+			t.Error("wrong errors:", nb.Errors)
+		}
+	}
+
+	check("GET", "/news?ids=3,4,1,5", "")
+	check("POST", "/news:batchGet", `{"ids":[3,4,1,5]}`)
+
+	// invalid
+	for _, req := range [][3]string{
+		{"GET", "/news?ids=", ""},
+		{"GET", "/news?ids=1,x", ""},
+		{"GET", "/news?ids=1,-2", ""},
+		{"GET", "/news?ids=1,2,3,4,5,6", ""},
+		{"POST", "/news:batchGet", "ololo"},
+		{"POST", "/news:batchGet", `{"ids":[]}`},
+	} {
+		if st, _, _ := requestMethod(t, req[0], req[1], req[2]); st != 400 {
+			t.Error("wrong status:", req, st)
+		}
+	}
+
+}
+
+func Test_codeStatus(t *testing.T) {
+	// codeStatus(code msg.Code) int
+
+	for code, want := range map[msg.Code]int{
+		msg.Code_OK:                 200,
+		msg.Code_NOT_FOUND:          404,
+		msg.Code_INVALID_ARGUMENT:   400,
+		msg.Code_UNAVAILABLE:        503,
+		msg.Code_DEADLINE_EXCEEDED:  504,
+		msg.Code_INTERNAL:           500,
+		msg.Code_CANCELED:           503,
+		msg.Code_ALREADY_EXISTS:     409,
+		msg.Code_RESOURCE_EXHAUSTED: 503,
+		msg.Code(100):               500, // unknown
+	} {
+		if got := codeStatus(code); got != want {
+			t.Errorf("%s: got %d, want %d", code, got, want)
+		}
+	}
+
+}
+
 func TestServer(t *testing.T) {
 
 	s, err := NewServer(&testConf)
@@ -211,6 +745,27 @@ func TestServer(t *testing.T) {
 		t.Errorf("wrong response body: %q", body)
 	}
 
+	// unavailable (6)
+	if st, body := requestError(t, "6"); st != 503 {
+		t.Error("wrong status:", st)
+	} else if body != "service unavailable\n" {
+		t.Errorf("wrong response body: %q", body)
+	}
+
+	// deadline exceeded (7)
+	if st, body := requestError(t, "7"); st != 504 {
+		t.Error("wrong status:", st)
+	} else if body != "gateway timeout\n" {
+		t.Errorf("wrong response body: %q", body)
+	}
+
+	// invalid argument (8)
+	if st, body := requestError(t, "8"); st != 400 {
+		t.Error("wrong status:", st)
+	} else if body != "bad request: some error\n" {
+		t.Errorf("wrong response body: %q", body)
+	}
+
 	// invalid identifier
 	if st, body := requestError(t, "ololo"); st != 400 {
 		t.Error("wrong status:", st)
@@ -226,3 +781,392 @@ func TestServer(t *testing.T) {
 	}
 
 }
+
+func TestServer_Shutdown(t *testing.T) {
+	// Shutdown() (err error)
+
+	var conf = testConf
+	addr, err := freeAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Addr = addr
+	conf.Subject = testConf.Subject + "_shutdown"
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var serveErr = make(chan error, 1)
+	go func() { serveErr <- s.Server.ListenAndServe() }()
+
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	var started = make(chan struct{})
+	_, err = nc.Subscribe(conf.Subject, func(req *nats.Msg) {
+		close(started)
+		time.Sleep(100 * time.Millisecond) // slow request
+		val, err := proto.Marshal(&msg.Response{
+			Item: &msg.NewsItem{ID: 1},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		req.Respond(val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // wait for the listener
+
+	var status = make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + conf.Addr + "/news/1")
+		if err != nil {
+			t.Error(err)
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(1 * time.Second):
+		t.Fatal("request not started")
+	}
+
+	// shutdown while the request is in-flight
+	if err = s.Shutdown(); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if st := <-status; st != 200 {
+		t.Error("wrong status:", st)
+	}
+	if err = <-serveErr; err != http.ErrServerClosed {
+		t.Error("unexpected serve error:", err)
+	}
+	if !s.Conn.IsClosed() {
+		t.Error("NATS connection is not closed")
+	}
+
+}
+
+func TestServer_getNews_tracing(t *testing.T) {
+
+	var rec = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(rec),
+	))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	var conf = testConf
+	conf.Subject = testConf.Subject + "_tracing"
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the fake storage handler continues the trace
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	var remote = make(chan trace.SpanContext, 1)
+	_, err = nc.Subscribe(conf.Subject, func(req *nats.Msg) {
+		remote <- trace.SpanContextFromContext(
+			tracing.Extract(context.Background(), req))
+		val, _ := proto.Marshal(&msg.Response{Item: &msg.NewsItem{ID: 1}})
+		req.Respond(val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest("GET", "/news/1", nil)
+	)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	s.Server.Handler.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatal("wrong status:", w.Code)
+	}
+
+	var spans = rec.Ended()
+	if len(spans) != 2 {
+		t.Fatal("wrong number of spans:", len(spans))
+	}
+	var client, server = spans[0], spans[1]
+	if server.Name() != "GET /news/{id}" ||
+		server.SpanContext().TraceID().String() != traceID {
+		t.Error("wrong server span:", server.Name(),
+			server.SpanContext().TraceID())
+	}
+	if client.Name() != conf.Subject ||
+		client.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("wrong client span:", client.Name(), client.Parent())
+	}
+	if sc := <-remote; sc.SpanID() != client.SpanContext().SpanID() ||
+		sc.TraceID().String() != traceID {
+		t.Error("trace context is not propagated:", sc)
+	}
+
+}
+
+func TestServer_getNews_timeout(t *testing.T) {
+
+	var conf = testConf
+	conf.Subject = testConf.Subject + "_timeout"
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	var timeouts = make(chan string, 1)
+	_, err = nc.Subscribe(conf.Subject, func(req *nats.Msg) {
+		timeouts <- req.Header.Get(msg.TimeoutHeader)
+		val, _ := proto.Marshal(&msg.Response{Item: &msg.NewsItem{ID: 1}})
+		req.Respond(val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var w = httptest.NewRecorder()
+	s.Server.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/news/1", nil))
+	if w.Code != 200 {
+		t.Fatal("wrong status:", w.Code)
+	}
+
+	// the remaining time of the HTTP request timeout
+	ms, err := strconv.ParseInt(<-timeouts, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms <= 0 || ms > conf.Timeout.Milliseconds() {
+		t.Error("wrong timeout:", ms)
+	}
+
+}
+
+func TestServer_getNews(t *testing.T) {
+	// getNews(w http.ResponseWriter, r *http.Request)
+
+	var conf = testConf
+	conf.NATSURL = natstest.Run(t, nil) // isolated
+	conf.Timeout = 200 * time.Millisecond
+
+	s, err := NewServer(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var get = func(id string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		s.Server.Handler.ServeHTTP(w,
+			httptest.NewRequest("GET", "/news/"+id, nil))
+		return w
+	}
+
+	// no storage service
+	if w := get("1"); w.Code != http.StatusServiceUnavailable {
+		t.Error("no responders: wrong status:", w.Code)
+	}
+
+	// fake storage service: 1 is found, 2 is not found, 3 hangs
+	nc, err := nats.Connect(conf.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	var release = make(chan struct{})
+	defer close(release)
+	_, err = nc.Subscribe(conf.Subject, func(req *nats.Msg) {
+		var id msg.ID
+		if err := proto.Unmarshal(req.Data, &id); err != nil {
+			t.Error(err)
+			return
+		}
+		var rsp msg.Response
+		switch id.ID {
+		case 1:
+			rsp.Item = &msg.NewsItem{ID: 1, Header: "head", Data: "data"}
+		case 2:
+			rsp.Code, rsp.Error = msg.Code_NOT_FOUND, "not found"
+		case 3:
+			<-release
+			return
+		}
+		val, _ := proto.Marshal(&rsp)
+		req.Respond(val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var w = get("1")
+	if w.Code != http.StatusOK {
+		t.Fatal("wrong status:", w.Code, w.Body.String())
+	}
+	var ni msg.NewsItem
+	if err = json.Unmarshal(w.Body.Bytes(), &ni); err != nil {
+		t.Fatal(err)
+	}
+	if ni.ID != 1 || ni.Header != "head" || ni.Data != "data" {
+		t.Error("wrong item:", ni.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Error("wrong content type:", ct)
+	}
+
+	if w = get("2"); w.Code != http.StatusNotFound {
+		t.Error("not found: wrong status:", w.Code)
+	}
+	if w = get("3"); w.Code != http.StatusGatewayTimeout {
+		t.Error("timeout: wrong status:", w.Code)
+	}
+	if w = get("x"); w.Code != http.StatusBadRequest {
+		t.Error("invalid id: wrong status:", w.Code)
+	}
+
+}
+
+// transportFunc is a Transport of a function
+type transportFunc func(ctx context.Context, m *nats.Msg) (*nats.Msg, error)
+
+func (tf transportFunc) RequestMsgWithContext(
+	ctx context.Context,
+	m *nats.Msg,
+) (
+	*nats.Msg,
+	error,
+) {
+	return tf(ctx, m)
+}
+
+func TestNewServerTransport(t *testing.T) {
+	// NewServerTransport(conf *Config, t Transport) (srv *Server)
+
+	var (
+		conf    = testConf
+		healthy = true
+	)
+	var s = NewServerTransport(&conf, transportFunc(func(
+		ctx context.Context,
+		m *nats.Msg,
+	) (
+		*nats.Msg,
+		error,
+	) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("no deadline")
+		}
+		var rsp proto.Message
+		switch m.Subject {
+		case conf.Subject:
+			var id msg.ID
+			if err := proto.Unmarshal(m.Data, &id); err != nil {
+				t.Error(err)
+			}
+			if id.ID != 1 {
+				return nil, nats.ErrNoResponders
+			}
+			rsp = &msg.Response{Item: &msg.NewsItem{ID: 1, Header: "head"}}
+		case conf.Subject + msg.HealthSuffix:
+			if !healthy {
+				return nil, nats.ErrNoResponders
+			}
+			rsp = &msg.HealthResponse{Instance: "direct", DB: "ok"}
+		default:
+			t.Error("unexpected subject:", m.Subject)
+			return nil, nats.ErrNoResponders
+		}
+		val, err := proto.Marshal(rsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &nats.Msg{Data: val}, nil
+	}))
+	if s.Conn != nil || s.Client.Transport == nil ||
+		s.Client.Subject != conf.Subject {
+		t.Fatal("wrong client")
+	}
+
+	var get = func(path string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		s.Server.Handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	var w = get("/news/1")
+	if w.Code != http.StatusOK {
+		t.Fatal("wrong status:", w.Code, w.Body.String())
+	}
+	var ni msg.NewsItem
+	if err := json.Unmarshal(w.Body.Bytes(), &ni); err != nil {
+		t.Fatal(err)
+	}
+	if ni.ID != 1 || ni.Header != "head" {
+		t.Error("wrong item:", ni.String())
+	}
+	if w = get("/news/2"); w.Code != http.StatusServiceUnavailable {
+		t.Error("no responders: wrong status:", w.Code)
+	}
+
+	// readyz without NATS
+	var h Health
+	if w = get("/readyz"); w.Code != http.StatusOK {
+		t.Error("wrong status:", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.Checks["nats"]; ok || h.Checks["storage"].Instance != "direct" {
+		t.Errorf("wrong checks: %v", h.Checks)
+	}
+	healthy = false
+	if w = get("/readyz"); w.Code != http.StatusServiceUnavailable {
+		t.Error("wrong status:", w.Code, w.Body.String())
+	}
+
+	if err := s.Shutdown(); err != nil {
+		t.Error(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+
+}
@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/lib/pq"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// errorCode returns msg.Code of given database or driver error.
+// It returns msg.Code_OK for nil.
+func errorCode(err error) msg.Code {
+	switch {
+	case err == nil:
+		return msg.Code_OK
+	case errors.Is(err, sql.ErrNoRows):
+		return msg.Code_NOT_FOUND
+	case errors.Is(err, context.DeadlineExceeded):
+		return msg.Code_DEADLINE_EXCEEDED
+	case errors.Is(err, context.Canceled):
+		return msg.Code_CANCELED
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, errStoreClosed):
+		return msg.Code_UNAVAILABLE
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErrorCode(pqErr)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return msg.Code_UNAVAILABLE // connection refused, reset, etc
+	}
+	return msg.Code_INTERNAL
+}
+
+// pqErrorCode returns msg.Code of given PostgreSQL error, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+// for the error codes
+func pqErrorCode(err *pq.Error) msg.Code {
+	switch err.Code {
+	case "23505": // unique_violation
+		return msg.Code_ALREADY_EXISTS
+	case "57014": // query_canceled (statement timeout)
+		return msg.Code_DEADLINE_EXCEEDED
+	case "40001": // serialization_failure (retry transaction)
+		return msg.Code_UNAVAILABLE
+	}
+	switch err.Code.Class() {
+	case "08", // connection exception
+		"57": // operator intervention (shutdown, etc)
+		return msg.Code_UNAVAILABLE
+	case "22", // data exception
+		"23": // integrity constraint violation
+		return msg.Code_INVALID_ARGUMENT
+	case "53": // insufficient resources
+		return msg.Code_RESOURCE_EXHAUSTED
+	}
+	return msg.Code_INTERNAL
+}
+
+// Temporary returns true if given database error is temporary,
+// e.g. the database is unreachable, and the operation can be retried.
+func Temporary(err error) bool {
+	switch errorCode(err) {
+	case msg.Code_UNAVAILABLE, msg.Code_DEADLINE_EXCEEDED:
+		return true
+	}
+	return false
+}
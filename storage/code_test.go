@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+func Test_errorCode(t *testing.T) {
+	// errorCode(err error) msg.Code
+
+	for _, tc := range []struct {
+		err  error
+		want msg.Code
+	}{
+		{nil, msg.Code_OK},
+		{sql.ErrNoRows, msg.Code_NOT_FOUND},
+		{fmt.Errorf("wrapped: %w", sql.ErrNoRows), msg.Code_NOT_FOUND},
+		{context.DeadlineExceeded, msg.Code_DEADLINE_EXCEEDED},
+		{context.Canceled, msg.Code_CANCELED},
+		{driver.ErrBadConn, msg.Code_UNAVAILABLE},
+		{sql.ErrConnDone, msg.Code_UNAVAILABLE},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, msg.Code_UNAVAILABLE},
+		{&pq.Error{Code: "23505"}, msg.Code_ALREADY_EXISTS},
+		{&pq.Error{Code: "57014"}, msg.Code_DEADLINE_EXCEEDED},
+		{&pq.Error{Code: "40001"}, msg.Code_UNAVAILABLE},
+		{&pq.Error{Code: "08006"}, msg.Code_UNAVAILABLE},
+		{&pq.Error{Code: "57P01"}, msg.Code_UNAVAILABLE},
+		{&pq.Error{Code: "22001"}, msg.Code_INVALID_ARGUMENT},
+		{&pq.Error{Code: "23502"}, msg.Code_INVALID_ARGUMENT},
+		{&pq.Error{Code: "53200"}, msg.Code_RESOURCE_EXHAUSTED},
+		{&pq.Error{Code: "XX000"}, msg.Code_INTERNAL},
+		{errors.New("some error"), msg.Code_INTERNAL},
+	} {
+		if got := errorCode(tc.err); got != tc.want {
+			t.Errorf("%v: got %s, want %s", tc.err, got, tc.want)
+		}
+	}
+
+}
@@ -0,0 +1,428 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+//go:build cockroachdb
+
+package storage
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// Tests of the DB need CockroachDB, see README for the test database
+// and run them with the cockroachdb tag
+//
+//	go test -tags cockroachdb ./...
+
+// ids of items filled up
+var testIDs []int64
+
+// open/fill/close
+func fillupTestDB(t *testing.T) {
+	db, err := sql.Open("postgres", testConf.OpenDBURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const createTable = `CREATE TABLE IF NOT EXISTS ` + tableName + ` (
+		id     SERIAL PRIMARY KEY,
+		header VARCHAR(255),
+		data   TEXT
+	)`
+
+	if _, err = db.Exec(createTable); err != nil {
+		t.Fatal(err)
+	}
+
+	const insertTest = `INSERT INTO ` + tableName + ` (header, data) VALUES
+		('one', 'one-data'),
+		('two', 'two-data'),
+		('three', 'three-data')
+	RETURNING id
+	`
+
+	rows, err := db.Query(insertTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		testIDs = append(testIDs, id)
+	}
+}
+
+func TestNewDB(t *testing.T) {
+	// NewDB(conf *Config) (db *DB, err error)
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if db.DB == nil {
+		t.Fatal("missing *sql.DB instance")
+	}
+
+	if mo := db.DB.Stats().MaxOpenConnections; mo != testConf.MaxOpenConns {
+		t.Error("wrong max open connections:", mo)
+	}
+
+	// unreachable database
+	var conf = testConf
+	conf.DBPort = 1
+	if db, err = NewDB(&conf); err == nil {
+		db.Close()
+		t.Error("missing error")
+	}
+
+}
+
+func testShouldHaveTable(t *testing.T) {
+	db, err := sql.Open("postgres", testConf.OpenDBURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// should not have any error
+	rows, err := db.Query(`SELECT * FROM ` + tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	// ignore result
+}
+
+func TestDB_Init(t *testing.T) {
+	// Init(ctx *Context) (err error)
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()             // fo the testShouldHaveTable
+	testShouldHaveTable(t) //
+}
+
+func TestDB_Select(t *testing.T) {
+	// Select(	ctx *Context, id int64) (ni *msg.NewsItem, err error)
+
+	fillupTestDB(t)
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range testIDs {
+		ni, err := db.Select(ctx, id)
+		if err != nil {
+			t.Error(err)
+		}
+		switch i {
+		case 0:
+			if ni.Header != "one" && ni.Data == "one-data" {
+				t.Error("wrong ni:", ni)
+			}
+		case 1:
+			if ni.Header != "two" && ni.Data == "two-data" {
+				t.Error("wrong ni:", ni)
+			}
+		case 2:
+			if ni.Header != "three" && ni.Data == "three-data" {
+				t.Error("wrong ni:", ni)
+			}
+		default:
+			t.Error("inexpected case:", ni, err)
+		}
+	}
+
+}
+
+func TestDB_SelectMany(t *testing.T) {
+	// SelectMany(ctx *Context, ids []int64) (items []*msg.NewsItem, err error)
+
+	if len(testIDs) == 0 {
+		fillupTestDB(t) // if not filled up yet
+	}
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := db.SelectMany(ctx, append(testIDs[:3:3], 90210))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatal("wrong number of items:", len(items))
+	}
+	for _, ni := range items {
+		if ni.ID != testIDs[0] && ni.ID != testIDs[1] && ni.ID != testIDs[2] {
+			t.Error("unexpected item:", ni)
+		}
+	}
+
+}
+
+func TestDB_List(t *testing.T) {
+	// List(ctx *Context, after, limit int64) (items []*msg.NewsItem, err error)
+
+	if len(testIDs) == 0 {
+		fillupTestDB(t) // if not filled up yet
+	}
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var last = testIDs[len(testIDs)-3] - 1 // before the last three
+
+	items, err := db.List(ctx, last, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatal("wrong number of items:", len(items))
+	}
+	if items[0].ID <= last || items[1].ID <= items[0].ID {
+		t.Error("wrong order:", items)
+	}
+
+	// the rest
+	if items, err = db.List(ctx, items[1].ID, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) == 0 {
+		t.Fatal("missing items")
+	}
+
+	// end
+	if items, err = db.List(ctx, items[len(items)-1].ID, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Error("unexpected items:", items)
+	}
+
+}
+
+func TestDB_Insert(t *testing.T) {
+	// Insert(ctx *Context, ni *msg.NewsItem) (ins *msg.NewsItem, err error)
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ins, err := db.Insert(ctx, &msg.NewsItem{
+		ID:     -1, // ignored
+		Header: "ins",
+		Data:   "ins-data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ins.ID <= 0 {
+		t.Error("missing id:", ins.ID)
+	}
+
+	ni, err := db.Select(ctx, ins.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ni.Header != "ins" || ni.Data != "ins-data" {
+		t.Error("wrong ni:", ni)
+	}
+
+}
+
+func TestDB_Update(t *testing.T) {
+	// Update(ctx *Context, ni *msg.NewsItem) (err error)
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ins, err := db.Insert(ctx, &msg.NewsItem{Header: "upd", Data: "upd-data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ins.Header, ins.Data = "upd-2", "upd-data-2"
+	if err := db.Update(ctx, ins); err != nil {
+		t.Fatal(err)
+	}
+
+	ni, err := db.Select(ctx, ins.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ni.Header != "upd-2" || ni.Data != "upd-data-2" {
+		t.Error("wrong ni:", ni)
+	}
+
+	ins.ID = 90210
+	if err := db.Update(ctx, ins); err != sql.ErrNoRows {
+		t.Error("unexpected error:", err)
+	}
+
+}
+
+func TestDB_Delete(t *testing.T) {
+	// Delete(ctx *Context, id int64) (err error)
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ctx = NewContext()
+
+	if err := db.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ins, err := db.Insert(ctx, &msg.NewsItem{Header: "del", Data: "del-data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete(ctx, ins.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Select(ctx, ins.ID); err != sql.ErrNoRows {
+		t.Error("unexpected error:", err)
+	}
+
+	if err := db.Delete(ctx, ins.ID); err != sql.ErrNoRows {
+		t.Error("unexpected error:", err)
+	}
+
+}
+
+func TestDB_Close(t *testing.T) {
+	// Close() error
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Error(err)
+	}
+	// should be ok twice
+	if err := db.Close(); err != nil {
+		t.Error(err)
+	}
+
+}
+
+func TestNewQQ_cockroachdb(t *testing.T) {
+	// NewQQ with the DB
+
+	fillupTestDB(t)
+
+	var ctx = NewContext()
+	defer ctx.Cancel()
+
+	db, err := NewDB(&testConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var conf = testConf
+	conf.Subject = testConf.Subject + "_cockroachdb"
+
+	qq, err := NewQQ(ctx, &conf, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qq.Close()
+
+	var ids = testIDs[len(testIDs)-3:]
+	requestNats(t, &conf, ids)
+	requestNatsModify(t, &conf)
+	requestNatsList(t, &conf, ids)
+	requestNatsBatch(t, &conf, ids)
+
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NewDirect creates QQ that handles requests in-process, without
+// NATS. Use its RequestMsgWithContext instead of the same method of
+// a NATS connection, e.g. as queryClient.Transport. Requests are
+// handled by goroutines of callers, thus the conf.Workers and the
+// conf.MaxPending are not used.
+func NewDirect(ctx *Context, conf *Config, store Store) (qq *QQ) {
+	qq = newQQ(ctx, conf)
+	var handlers, health = qq.handlers(conf, store)
+	qq.direct = make(map[string]*handler, len(handlers)+1)
+	for _, h := range append(handlers, health) {
+		qq.direct[h.subject] = h
+	}
+	return
+}
+
+// RequestMsgWithContext handles the request in-process and returns
+// its response. The request is limited by its msg.TimeoutHeader and
+// by the ctx, thus a canceled ctx stops the request. It returns the
+// nats.ErrNoResponders for an unknown subject or if the QQ is closed.
+// Only a QQ created by the NewDirect handles requests this way.
+func (qq *QQ) RequestMsgWithContext(
+	ctx context.Context,
+	req *nats.Msg,
+) (
+	rsp *nats.Msg,
+	err error,
+) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var h = qq.direct[req.Subject]
+	if h == nil {
+		return nil, nats.ErrNoResponders
+	}
+
+	qq.mx.RLock()
+	if qq.closed {
+		qq.mx.RUnlock()
+		return nil, nats.ErrNoResponders
+	}
+	qq.wg.Add(1) // the Close waits for it
+	atomic.AddInt64(&qq.inFlight, 1)
+	qq.mx.RUnlock()
+	defer qq.wg.Done()
+	defer atomic.AddInt64(&qq.inFlight, -1)
+
+	var deadline = requestDeadline(req)
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	var val []byte
+	if val, err = qq.encode(req, h, qq.process(ctx, req, h, deadline)); err != nil {
+		return
+	}
+	return &nats.Msg{Subject: req.Reply, Data: val}, nil
+}
@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+func TestNewDirect(t *testing.T) {
+	// NewDirect(ctx *Context, conf *Config, store Store) (qq *QQ)
+
+	var ctx = NewContext()
+	defer ctx.Cancel()
+
+	var ms, _ = testMemStore(t)
+	var qq = NewDirect(ctx, &testConf, ms)
+	if qq.Conn != nil || len(qq.Subs) != 0 {
+		t.Error("connected")
+	}
+	for _, suffix := range []string{"", msg.InsertSuffix, msg.UpdateSuffix,
+		msg.DeleteSuffix, msg.ListSuffix, msg.BatchSuffix, msg.HealthSuffix} {
+		if qq.direct[testConf.Subject+suffix] == nil {
+			t.Errorf("missing handler of %q", testConf.Subject+suffix)
+		}
+	}
+	if err := qq.Close(); err != nil {
+		t.Error(err)
+	}
+
+}
+
+func TestQQ_RequestMsgWithContext(t *testing.T) {
+	// RequestMsgWithContext(ctx context.Context,
+	//     req *nats.Msg) (rsp *nats.Msg, err error)
+
+	var sctx = NewContext()
+	defer sctx.Cancel()
+
+	var (
+		ms, ids = testMemStore(t)
+		qq      = NewDirect(sctx, &testConf, ms)
+		ctx     = context.Background()
+	)
+
+	var request = func(subject string) (*nats.Msg, error) {
+		var req = nats.NewMsg(subject)
+		req.Header.Set(msg.TimeoutHeader, "1000")
+		req.Data = marshal(t, &msg.ID{ID: ids[1]})
+		return qq.RequestMsgWithContext(ctx, req)
+	}
+
+	// handled
+	rsp, err := request(testConf.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mrsp msg.Response
+	if err = proto.Unmarshal(rsp.Data, &mrsp); err != nil {
+		t.Fatal(err)
+	}
+	if mrsp.Code != msg.Code_OK || mrsp.Item == nil ||
+		mrsp.Item.Header != "two" {
+		t.Errorf("unexpected response: %v", &mrsp)
+	}
+	if qq.InFlight() != 0 {
+		t.Error("unexpected in-flight requests:", qq.InFlight())
+	}
+
+	// health
+	rsp, err = request(testConf.Subject + msg.HealthSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hrsp msg.HealthResponse
+	if err = proto.Unmarshal(rsp.Data, &hrsp); err != nil {
+		t.Fatal(err)
+	}
+	if hrsp.Instance != qq.instance || hrsp.DB != "ok" {
+		t.Errorf("unexpected health response: %v", &hrsp)
+	}
+
+	// unknown subject
+	if _, err = request(testConf.Subject + ".unknown"); !errors.Is(err,
+		nats.ErrNoResponders) {
+		t.Error("unexpected error:", err)
+	}
+
+	// canceled
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = request(testConf.Subject); !errors.Is(err, context.Canceled) {
+		t.Error("unexpected error:", err)
+	}
+
+	// canceled while handling
+	var handled = make(chan error, 1)
+	qq.direct["test.block"] = &handler{
+		subject: "test.block",
+		handle: func(rctx *Context, _ *nats.Msg) proto.Message {
+			<-rctx.Ctx.Done()
+			handled <- rctx.Ctx.Err()
+			return &msg.Response{}
+		},
+		failure: itemFailure,
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err = request("test.block"); err != nil {
+		t.Error(err)
+	}
+	select {
+	case err = <-handled:
+		if !errors.Is(err, context.Canceled) {
+			t.Error("unexpected error:", err)
+		}
+	default:
+		t.Error("handler not stopped by the caller")
+	}
+
+	// closed
+	ctx = context.Background()
+	if err = qq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = request(testConf.Subject); !errors.Is(err,
+		nats.ErrNoResponders) {
+		t.Error("unexpected error:", err)
+	}
+
+}
@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// NATSReadyTimeout is max time to wait for embedded NATS server start.
+const NATSReadyTimeout = 5 * time.Second
+
+// natsLogger writes logs of embedded NATS server using slog
+type natsLogger struct {
+	log *slog.Logger
+}
+
+// Noticef logs at debug level, notices are the startup banner mostly
+func (nl natsLogger) Noticef(format string, v ...interface{}) {
+	nl.log.Debug(fmt.Sprintf(format, v...))
+}
+
+func (nl natsLogger) Warnf(format string, v ...interface{}) {
+	nl.log.Warn(fmt.Sprintf(format, v...))
+}
+
+func (nl natsLogger) Fatalf(format string, v ...interface{}) {
+	nl.log.Error(fmt.Sprintf(format, v...))
+}
+
+func (nl natsLogger) Errorf(format string, v ...interface{}) {
+	nl.log.Error(fmt.Sprintf(format, v...))
+}
+
+func (nl natsLogger) Debugf(format string, v ...interface{}) {
+	nl.log.Debug(fmt.Sprintf(format, v...))
+}
+
+func (nl natsLogger) Tracef(format string, v ...interface{}) {
+	nl.log.Debug(fmt.Sprintf(format, v...))
+}
+
+// StartNATS starts in-process NATS server listening on the addr, port
+// 0 is a random port. The server has no authentication and no TLS,
+// it's for local development. It shuts down when the ctx canceled,
+// use WaitForShutdown of the server to wait for that.
+func StartNATS(ctx *Context, addr string) (ns *server.Server, err error) {
+	host, sport, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("embedded NATS address: %v", err)
+	}
+	port, err := strconv.Atoi(sport)
+	if err != nil {
+		return nil, fmt.Errorf("embedded NATS port: %v", err)
+	}
+	if port == 0 {
+		port = server.RANDOM_PORT
+	}
+	var opts = &server.Options{
+		ServerName: "storage-embedded",
+		Host:       host,
+		Port:       port,
+		NoSigs:     true, // the service handles signals
+	}
+	if ns, err = server.NewServer(opts); err != nil {
+		return nil, fmt.Errorf("embedded NATS: %v", err)
+	}
+	ns.SetLoggerV2(natsLogger{slog.With("component", "nats-server")},
+		false, false, false)
+	go ns.Start()
+	if !ns.ReadyForConnections(NATSReadyTimeout) {
+		ns.Shutdown()
+		return nil, errors.New("embedded NATS server is not ready")
+	}
+	go func() {
+		<-ctx.Ctx.Done()
+		ns.Shutdown()
+	}()
+	slog.Info("embedded NATS server started", "url", ns.ClientURL())
+	return
+}
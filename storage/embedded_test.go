@@ -0,0 +1,102 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestStartNATS(t *testing.T) {
+	// StartNATS(ctx *Context, addr string) (ns *server.Server, err error)
+
+	var ctx = NewContext()
+	defer ctx.Cancel()
+
+	ns, err := StartNATS(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(ns.ClientURL(), ":0") {
+		t.Error("random port is not used:", ns.ClientURL())
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if err = nc.Publish("test", nil); err != nil {
+		t.Error(err)
+	}
+
+	// shutdown with the ctx
+	ctx.Cancel()
+	ns.WaitForShutdown()
+	if ns.Running() {
+		t.Error("still running")
+	}
+
+	var other = NewContext()
+	defer other.Cancel()
+	for _, addr := range []string{"localhost", "localhost:x"} {
+		if _, err = StartNATS(other, addr); err == nil {
+			t.Errorf("%q: missing error", addr)
+		}
+	}
+
+}
+
+func Test_natsLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	var nl = natsLogger{slog.New(slog.NewTextHandler(&buf, nil))}
+	nl.Noticef("notice %d", 1) // debug
+	nl.Warnf("warn %d", 2)
+	nl.Errorf("error %d", 3)
+	nl.Fatalf("fatal %d", 4)
+	nl.Debugf("debug %d", 5)
+
+	for _, want := range []string{
+		`level=WARN msg="warn 2"`,
+		`level=ERROR msg="error 3"`,
+		`level=ERROR msg="fatal 4"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Error("missing log record:", want)
+		}
+	}
+	// not logged by the level
+	if strings.Contains(buf.String(), "notice") ||
+		strings.Contains(buf.String(), "debug") {
+		t.Error("unexpected debug record")
+	}
+
+}
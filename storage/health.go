@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// Version of the storage service, set it using
+//
+//	go build -ldflags "-X github.com/logrusorgru/news_micro_storage_system/storage.Version=v1.2.3"
+var Version = "dev"
+
+// defaultInstanceID is hostname-pid
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// InFlight returns number of accepted requests not finished yet.
+func (qq *QQ) InFlight() int64 {
+	return atomic.LoadInt64(&qq.inFlight)
+}
+
+// healthFailure creates msg.HealthResponse with given error.
+func healthFailure(code msg.Code, detail string) proto.Message {
+	return &msg.HealthResponse{Code: code, Error: detail}
+}
+
+// healthHandler for health requests.
+func (qq *QQ) healthHandler(store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
+		var hr msg.HealthRequest
+		if fail := qq.decode(req, &hr, healthFailure); fail != nil {
+			return fail
+		}
+		var rsp = msg.HealthResponse{
+			Instance: qq.instance,
+			Version:  Version,
+			Uptime:   int64(time.Since(qq.started) / time.Millisecond),
+			DB:       "ok",
+			InFlight: qq.InFlight(),
+		}
+		if err := store.Ping(ctx); err != nil {
+			rsp.DB = err.Error()
+		}
+		return &rsp
+	}
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+func TestQQ_InFlight(t *testing.T) {
+	// InFlight() int64
+
+	var (
+		qq      = &QQ{jobs: make(chan job, 2)}
+		release = make(chan struct{})
+		h       = handler{
+			handle: func(_ *Context, req *nats.Msg) proto.Message {
+				<-release
+				return &msg.Response{}
+			},
+			failure: itemFailure,
+		}
+		dispatch = qq.dispatch(&h)
+	)
+
+	dispatch(&nats.Msg{})
+	dispatch(&nats.Msg{})
+	if n := qq.InFlight(); n != 2 {
+		t.Error("wrong in-flight requests:", n)
+	}
+
+	qq.wg.Add(1)
+	go qq.worker()
+	close(release)
+	close(qq.jobs)
+	qq.wg.Wait()
+
+	if n := qq.InFlight(); n != 0 {
+		t.Error("wrong in-flight requests:", n)
+	}
+
+}
+
+func TestQQ_healthHandler(t *testing.T) {
+	// healthHandler(store Store) func(ctx *Context, req *nats.Msg) proto.Message
+
+	var conf = testConf
+	conf.DBPort = 1 // unreachable
+	conf.StatementTimeout = 1 * time.Second
+
+	sdb, err := sql.Open("postgres", conf.OpenDBURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db = &DB{DB: sdb, stmtTimeout: conf.StatementTimeout}
+	defer db.Close()
+
+	ctx := NewContext()
+	defer ctx.Cancel()
+
+	var qq = &QQ{
+		instance: "test-instance",
+		started:  time.Now().Add(-time.Second),
+		inFlight: 5,
+	}
+	rsp, ok := qq.healthHandler(db)(ctx, &nats.Msg{}).(*msg.HealthResponse)
+	if !ok {
+		t.Fatal("unexpected response type")
+	}
+	if rsp.Instance != "test-instance" || rsp.Version != Version {
+		t.Errorf("wrong instance: %s %s", rsp.Instance, rsp.Version)
+	}
+	if rsp.Uptime < 1000 {
+		t.Error("wrong uptime:", rsp.Uptime)
+	}
+	if rsp.InFlight != 5 {
+		t.Error("wrong in-flight requests:", rsp.InFlight)
+	}
+	if rsp.DB == "ok" || rsp.DB == "" {
+		t.Error("unreachable database is ok:", rsp.DB)
+	}
+
+	// malformed request
+	var fail = qq.healthHandler(db)(ctx, &nats.Msg{Data: []byte{0xff}})
+	if frsp, ok := fail.(*msg.HealthResponse); !ok {
+		t.Error("unexpected response type")
+	} else if frsp.Code != msg.Code_INVALID_ARGUMENT || frsp.Error == "" {
+		t.Errorf("wrong failure: %s %q", frsp.Code, frsp.Error)
+	}
+	if qq.Stats().DecodeErrors != 1 {
+		t.Error("decode error not counted")
+	}
+
+}
+
+func Test_defaultInstanceID(t *testing.T) {
+	// defaultInstanceID() string
+
+	if id := defaultInstanceID(); id == "" || id != defaultInstanceID() {
+		t.Error("wrong instance ID:", id)
+	}
+
+}
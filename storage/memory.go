@@ -0,0 +1,209 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// A MemStore keeps news items in memory. It's a Store for tests and
+// local development, the items are lost on exit. It's safe for
+// concurrent use.
+type MemStore struct {
+	mx     sync.RWMutex
+	items  map[int64]*msg.NewsItem // by id
+	lastID int64                   // last inserted
+	closed bool
+}
+
+// NewMemStore creates new empty MemStore.
+func NewMemStore() (ms *MemStore) {
+	ms = new(MemStore)
+	ms.items = make(map[int64]*msg.NewsItem)
+	return
+}
+
+// errStoreClosed is returned by a closed MemStore
+var errStoreClosed = errors.New("store closed")
+
+// check the ctx and the MemStore, call it under the lock
+func (ms *MemStore) check(ctx *Context) error {
+	if err := ctx.Ctx.Err(); err != nil {
+		return err
+	}
+	if ms.closed {
+		return errStoreClosed
+	}
+	return nil
+}
+
+// copyItem to not share items with callers
+func copyItem(ni *msg.NewsItem) *msg.NewsItem {
+	return &msg.NewsItem{ID: ni.ID, Header: ni.Header, Data: ni.Data}
+}
+
+// Select news item by id.
+func (ms *MemStore) Select(ctx *Context, id int64) (*msg.NewsItem, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	if err := ms.check(ctx); err != nil {
+		return nil, err
+	}
+	var ni, ok = ms.items[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyItem(ni), nil
+}
+
+// SelectMany news items by ids, missing items are skipped.
+func (ms *MemStore) SelectMany(
+	ctx *Context,
+	ids []int64,
+) (
+	items []*msg.NewsItem,
+	err error,
+) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	if err = ms.check(ctx); err != nil {
+		return
+	}
+	var seen = make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if ni, ok := ms.items[id]; ok && !seen[id] {
+			items = append(items, copyItem(ni))
+			seen[id] = true
+		}
+	}
+	return
+}
+
+// List news items with id greater than the after ordered by id.
+func (ms *MemStore) List(
+	ctx *Context,
+	after int64,
+	limit int64,
+) (
+	items []*msg.NewsItem,
+	err error,
+) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	if err = ms.check(ctx); err != nil {
+		return
+	}
+	var ids []int64
+	for id := range ms.items {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if int64(len(items)) >= limit {
+			break
+		}
+		items = append(items, copyItem(ms.items[id]))
+	}
+	return
+}
+
+// Insert news item with next id.
+func (ms *MemStore) Insert(
+	ctx *Context,
+	ni *msg.NewsItem,
+) (
+	ins *msg.NewsItem,
+	err error,
+) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if err = ms.check(ctx); err != nil {
+		return
+	}
+	ms.lastID++
+	ins = copyItem(ni)
+	ins.ID = ms.lastID
+	ms.items[ins.ID] = copyItem(ins)
+	return
+}
+
+// Update header and data of news item by its id.
+func (ms *MemStore) Update(ctx *Context, ni *msg.NewsItem) (err error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if err = ms.check(ctx); err != nil {
+		return
+	}
+	if _, ok := ms.items[ni.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	ms.items[ni.ID] = copyItem(ni)
+	return
+}
+
+// Delete news item by id.
+func (ms *MemStore) Delete(ctx *Context, id int64) (err error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if err = ms.check(ctx); err != nil {
+		return
+	}
+	if _, ok := ms.items[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(ms.items, id)
+	return
+}
+
+// Ping returns error if the MemStore is closed.
+func (ms *MemStore) Ping(ctx *Context) error {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	return ms.check(ctx)
+}
+
+// Close the MemStore, it keeps its items but all calls fail.
+func (ms *MemStore) Close() error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	ms.closed = true
+	return nil
+}
@@ -0,0 +1,274 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// itemIDs of items
+func itemIDs(items []*msg.NewsItem) (ids []int64) {
+	for _, ni := range items {
+		ids = append(ids, ni.ID)
+	}
+	return
+}
+
+// equal ids
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fillMemStore with given number of items, it returns their ids
+func fillMemStore(t *testing.T, ms *MemStore, n int) (ids []int64) {
+	var ctx = NewContext()
+	defer ctx.Cancel()
+	for i := 0; i < n; i++ {
+		ni, err := ms.Insert(ctx, &msg.NewsItem{Header: "h", Data: "d"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, ni.ID)
+	}
+	return
+}
+
+func TestMemStore_Insert(t *testing.T) {
+	// Insert(ctx *Context, ni *msg.NewsItem) (ins *msg.NewsItem, err error)
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	defer ctx.Cancel()
+
+	var ni = &msg.NewsItem{ID: 100, Header: "head", Data: "data"}
+	ins, err := ms.Insert(ctx, ni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ins.ID != 1 || ins.Header != "head" || ins.Data != "data" {
+		t.Error("wrong inserted item:", ins)
+	}
+	if ni.ID != 100 {
+		t.Error("the given item modified")
+	}
+	if ins, err = ms.Insert(ctx, ni); err != nil {
+		t.Fatal(err)
+	} else if ins.ID != 2 {
+		t.Error("wrong next id:", ins.ID)
+	}
+
+	// not shared
+	ins.Header = "modified"
+	if sel, err := ms.Select(ctx, 2); err != nil {
+		t.Error(err)
+	} else if sel.Header != "head" {
+		t.Error("inserted item shared with caller")
+	}
+
+}
+
+func TestMemStore_Select(t *testing.T) {
+	// Select(ctx *Context, id int64) (*msg.NewsItem, error)
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+		ids = fillMemStore(t, ms, 2)
+	)
+	defer ctx.Cancel()
+
+	if ni, err := ms.Select(ctx, ids[1]); err != nil {
+		t.Error(err)
+	} else if ni.ID != ids[1] {
+		t.Error("wrong item:", ni)
+	}
+	if _, err := ms.Select(ctx, 90210); err != sql.ErrNoRows {
+		t.Error("unexpected error:", err)
+	}
+
+}
+
+func TestMemStore_SelectMany(t *testing.T) {
+	// SelectMany(ctx *Context, ids []int64) (items []*msg.NewsItem,
+	//     err error)
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	defer ctx.Cancel()
+	fillMemStore(t, ms, 3)
+
+	items, err := ms.SelectMany(ctx, []int64{3, 90210, 1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemIDs(items); !equalIDs(got, []int64{3, 1}) {
+		t.Error("wrong items:", got)
+	}
+
+}
+
+func TestMemStore_List(t *testing.T) {
+	// List(ctx *Context, after, limit int64) (items []*msg.NewsItem,
+	//     err error)
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	defer ctx.Cancel()
+	fillMemStore(t, ms, 5)
+	if err := ms.Delete(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		after, limit int64
+		want         []int64
+	}{
+		{0, 10, []int64{1, 2, 4, 5}},
+		{0, 2, []int64{1, 2}},
+		{2, 2, []int64{4, 5}},
+		{5, 2, nil},
+		{0, 0, nil},
+	} {
+		items, err := ms.List(ctx, tt.after, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := itemIDs(items); !equalIDs(got, tt.want) {
+			t.Errorf("List(%d, %d): %v, want %v", tt.after, tt.limit, got,
+				tt.want)
+		}
+	}
+
+}
+
+func TestMemStore_Update(t *testing.T) {
+	// Update(ctx *Context, ni *msg.NewsItem) (err error)
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	defer ctx.Cancel()
+	fillMemStore(t, ms, 1)
+
+	err := ms.Update(ctx, &msg.NewsItem{ID: 1, Header: "h-2", Data: "d-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ni, err := ms.Select(ctx, 1); err != nil {
+		t.Error(err)
+	} else if ni.Header != "h-2" || ni.Data != "d-2" {
+		t.Error("not updated:", ni)
+	}
+	err = ms.Update(ctx, &msg.NewsItem{ID: 90210})
+	if err != sql.ErrNoRows {
+		t.Error("unexpected error:", err)
+	}
+
+}
+
+func TestMemStore_Delete(t *testing.T) {
+	// Delete(ctx *Context, id int64) (err error)
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	defer ctx.Cancel()
+	fillMemStore(t, ms, 1)
+
+	if err := ms.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Delete(ctx, 1); err != sql.ErrNoRows {
+		t.Error("unexpected error:", err)
+	}
+	if _, err := ms.Select(ctx, 1); err != sql.ErrNoRows {
+		t.Error("not deleted:", err)
+	}
+
+}
+
+func TestMemStore_Close(t *testing.T) {
+	// Close() error
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	defer ctx.Cancel()
+	fillMemStore(t, ms, 1)
+
+	if err := ms.Ping(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := ms.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := ms.Ping(ctx); errorCode(err) != msg.Code_UNAVAILABLE {
+		t.Error("unexpected error:", err)
+	}
+	if _, err := ms.Select(ctx, 1); errorCode(err) != msg.Code_UNAVAILABLE {
+		t.Error("unexpected error:", err)
+	}
+
+}
+
+func TestMemStore_context(t *testing.T) {
+
+	var (
+		ms  = NewMemStore()
+		ctx = NewContext()
+	)
+	ctx.Cancel()
+
+	if _, err := ms.Insert(ctx, &msg.NewsItem{}); !errors.Is(err, context.Canceled) {
+		t.Error("unexpected error:", err)
+	}
+	if _, err := ms.List(ctx, 0, 10); !errors.Is(err, context.Canceled) {
+		t.Error("unexpected error:", err)
+	}
+
+}
@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+const metricsNamespace = "storage"
+
+// MetricsHandler returns HTTP handler of Prometheus metrics of
+// the given collectors, Go runtime and the process. Use it with
+// collectors of a DB and a QQ.
+func MetricsHandler(cs ...prometheus.Collector) http.Handler {
+	var reg = prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	reg.MustRegister(cs...)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// newQueryDuration histogram of the DB
+func newQueryDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by query.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query"})
+}
+
+// observe query latency
+func (db *DB) observe(query string, start time.Time) {
+	if db.queryDuration != nil {
+		db.queryDuration.WithLabelValues(query).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// Collectors of the DB metrics: query latency and
+// connections pool stats.
+func (db *DB) Collectors() []prometheus.Collector {
+	var cs = []prometheus.Collector{
+		collectors.NewDBStatsCollector(db.DB, db.name),
+	}
+	if db.queryDuration != nil {
+		cs = append(cs, db.queryDuration)
+	}
+	return cs
+}
+
+// metrics of the QQ
+type qqMetrics struct {
+	requests *prometheus.CounterVec   // subject, code
+	duration *prometheus.HistogramVec // subject
+}
+
+func newQQMetrics() *qqMetrics {
+	return &qqMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Handled requests by subject and response code.",
+		}, []string{"subject", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Request handling latency by subject.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"subject"}),
+	}
+}
+
+// responseCode of a response
+func responseCode(rsp proto.Message) msg.Code {
+	switch r := rsp.(type) {
+	case *msg.Response:
+		return r.Code
+	case *msg.ListResponse:
+		return r.Code
+	case *msg.BatchResponse:
+		return r.Code
+	case *msg.HealthResponse:
+		return r.Code
+	}
+	return msg.Code_OK
+}
+
+// observe handled request, zero start means not handled request
+func (qq *QQ) observe(subject string, code msg.Code, start time.Time) {
+	if qq.metrics == nil {
+		return
+	}
+	qq.metrics.requests.WithLabelValues(subject, code.String()).Inc()
+	if !start.IsZero() {
+		qq.metrics.duration.WithLabelValues(subject).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// Collectors of the QQ metrics: requests, latency, in-flight
+// requests and the Stats.
+func (qq *QQ) Collectors() (cs []prometheus.Collector) {
+	if qq.metrics != nil {
+		cs = append(cs, qq.metrics.requests, qq.metrics.duration)
+	}
+	var counter = func(name, help string, val func(Stats) uint64) {
+		cs = append(cs, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(val(qq.Stats()))
+		}))
+	}
+	counter("decode_errors_total", "Malformed requests.",
+		func(s Stats) uint64 { return s.DecodeErrors })
+	counter("encode_errors_total", "Responses failed to encode.",
+		func(s Stats) uint64 { return s.EncodeErrors })
+	counter("reply_errors_total", "Responses failed to send.",
+		func(s Stats) uint64 { return s.ReplyErrors })
+	counter("panics_total", "Recovered panics of handlers.",
+		func(s Stats) uint64 { return s.Panics })
+	counter("nats_disconnects_total", "NATS connection lost.",
+		func(s Stats) uint64 { return s.Disconnects })
+	counter("nats_reconnects_total", "NATS connection restored.",
+		func(s Stats) uint64 { return s.Reconnects })
+	cs = append(cs, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "in_flight_requests",
+		Help:      "Accepted requests not finished yet.",
+	}, func() float64 {
+		return float64(qq.InFlight())
+	}))
+	return
+}
@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+func Test_responseCode(t *testing.T) {
+	// responseCode(rsp proto.Message) msg.Code
+
+	for _, tt := range []struct {
+		rsp  proto.Message
+		code msg.Code
+	}{
+		{&msg.Response{Code: msg.Code_NOT_FOUND}, msg.Code_NOT_FOUND},
+		{&msg.ListResponse{Code: msg.Code_INTERNAL}, msg.Code_INTERNAL},
+		{&msg.BatchResponse{}, msg.Code_OK},
+		{&msg.HealthResponse{}, msg.Code_OK},
+		{&msg.HealthResponse{Code: msg.Code_INVALID_ARGUMENT},
+			msg.Code_INVALID_ARGUMENT},
+	} {
+		if code := responseCode(tt.rsp); code != tt.code {
+			t.Errorf("wrong code of %T: %s", tt.rsp, code)
+		}
+	}
+
+}
+
+func TestMetricsHandler(t *testing.T) {
+	// MetricsHandler(cs ...prometheus.Collector) http.Handler
+
+	var qq = &QQ{metrics: newQQMetrics()}
+	qq.stats.DecodeErrors = 3
+	qq.observe("get", msg.Code_NOT_FOUND, time.Now())
+	qq.observe("get", msg.Code_RESOURCE_EXHAUSTED, time.Time{})
+
+	var rec = httptest.NewRecorder()
+	MetricsHandler(qq.Collectors()...).ServeHTTP(rec,
+		httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatal("wrong status:", rec.Code)
+	}
+
+	var body = rec.Body.String()
+	for _, want := range []string{
+		`storage_requests_total{code="NOT_FOUND",subject="get"} 1`,
+		`storage_requests_total{code="RESOURCE_EXHAUSTED",subject="get"} 1`,
+		`storage_request_duration_seconds_count{subject="get"} 1`,
+		`storage_decode_errors_total 3`,
+		`storage_in_flight_requests 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Error("missing metric:", want)
+		}
+	}
+
+	// nil metrics
+	qq.metrics = nil
+	qq.observe("get", msg.Code_OK, time.Now())
+	var db DB
+	db.observe("select", time.Now())
+
+}
+
+func TestDB_Collectors(t *testing.T) {
+	// Collectors() []prometheus.Collector
+
+	sqlDB, err := sql.Open("postgres", "postgresql://test@127.0.0.1:1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	var db = &DB{DB: sqlDB, name: "test_db"}
+	var rec = httptest.NewRecorder()
+	MetricsHandler(db.Collectors()...).ServeHTTP(rec,
+		httptest.NewRequest("GET", "/metrics", nil))
+
+	var body = rec.Body.String()
+	if !strings.Contains(body, `go_sql_open_connections{db_name="test_db"} 0`) {
+		t.Error("missing pool metrics of the database:", body)
+	}
+
+}
@@ -28,14 +28,35 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/logrusorgru/news_micro_storage_system/config"
+	"github.com/logrusorgru/news_micro_storage_system/logging"
+	"github.com/logrusorgru/news_micro_storage_system/migrations"
 	"github.com/logrusorgru/news_micro_storage_system/msg"
+	"github.com/logrusorgru/news_micro_storage_system/natsconf"
+	"github.com/logrusorgru/news_micro_storage_system/tracing"
 )
 
 // hardcoded
@@ -43,6 +64,12 @@ const (
 	tableName = "news_items" // db table name
 )
 
+// tracer of the storage, it's looked up for every span, thus spans
+// go to current global tracer provider
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/logrusorgru/news_micro_storage_system/storage")
+}
+
 // defautls
 const (
 	DBAddr  = "localhost"
@@ -51,6 +78,31 @@ const (
 	DBUser  = msg.Name
 	NATSURL = nats.DefaultURL
 	Subject = msg.Name
+	Queue   = msg.Name
+
+	DBSSLMode = "disable" // no TLS by default
+
+	Backend = BackendCockroachDB // storage backend
+
+	// EnvPrefix of environment variables of the config
+	EnvPrefix = "NEWS_STORAGE_"
+
+	MaxListLimit = 100 // max items per list request
+	MaxBatchSize = 100 // max items per batch request
+
+	DrainTimeout = 30 * time.Second // graceful shutdown timeout
+
+	MaxOpenConns     = 32               // max open DB connections
+	MaxIdleConns     = 16               // max idle DB connections
+	ConnMaxLifetime  = 30 * time.Minute // max DB connection lifetime
+	ConnMaxIdleTime  = 5 * time.Minute  // max DB connection idle time
+	StatementTimeout = 5 * time.Second  // per-query timeout
+	DBRetryWait      = 2 * time.Second  // wait between connection attempts
+
+	Workers      = 16                               // request handlers
+	MaxPending   = 1024                             // pending requests
+	PendingMsgs  = nats.DefaultSubPendingMsgsLimit  // per subscription
+	PendingBytes = nats.DefaultSubPendingBytesLimit // per subscription
 )
 
 // Context represetns cacnelation with error.
@@ -84,6 +136,14 @@ func (c *Context) Terminatef(format string, args ...interface{}) {
 	c.Terminate(fmt.Errorf(format, args...))
 }
 
+// WithContext returns copy of the Context with given golang context,
+// e.g. a context of a request. The copy shares the Cancel and the Err.
+func (c *Context) WithContext(ctx context.Context) *Context {
+	var cp = *c
+	cp.Ctx = ctx
+	return &cp
+}
+
 // Errs or nil if context was canceled by a legal reason.
 // Only first error read has meaning.
 func (c *Context) Errs() (err error) {
@@ -97,6 +157,10 @@ func (c *Context) Errs() (err error) {
 // A Config represents all storage configurations
 type Config struct {
 
+	// Store
+
+	Backend string // storage backend: cockroachdb or memory
+
 	// CockrouachDB
 
 	DBAddr string // address (localhost)
@@ -104,21 +168,81 @@ type Config struct {
 	DBName string // databas name
 	DBUser string // database user name
 
+	DBPassword     string // database password, keep empty and use file or env
+	DBPasswordFile string // file with database password
+
+	DBSSLMode     string // disable, require, verify-ca or verify-full
+	DBSSLRootCert string // CA certificate file
+	DBSSLCert     string // client certificate file
+	DBSSLKey      string // client key file
+
+	MaxOpenConns     int           // max open connections, 0 for no limit
+	MaxIdleConns     int           // max idle connections, 0 for no idle
+	ConnMaxLifetime  time.Duration // max connection lifetime, 0 for no limit
+	ConnMaxIdleTime  time.Duration // max connection idle time, 0 for no limit
+	StatementTimeout time.Duration // per-query timeout, 0 for no timeout
+	DBRetryWait      time.Duration // wait between attempts, 0 for no retry
+
 	// NATS
 
 	NATSURL string // nats url
 	Subject string // nats subject name
+	Queue   string // nats queue group name, empty for no group
+
+	NATSEmbedded string // address of embedded NATS server, optional
+
+	InstanceID string // ID in health responses, hostname-pid if empty
+
+	MetricsListen string // address of metrics HTTP listener, optional
+
+	Log   logging.Config // structured logging
+	Trace tracing.Config // OpenTelemetry tracing
+
+	NATS natsconf.Config // NATS authentication and TLS
+
+	DrainTimeout time.Duration // graceful shutdown timeout
+
+	// Limits
+
+	MaxListLimit int64 // max items per list request
+	MaxBatchSize int   // max items per batch request
+
+	// Workers
+
+	Workers      int // number of concurrent request handlers
+	MaxPending   int // max requests waiting for a handler
+	PendingMsgs  int // NATS subscription pending messages limit
+	PendingBytes int // NATS subscription pending bytes limit
 }
 
 // NewConfig with defaults
 func NewConfig() (c *Config) {
 	c = new(Config)
+	c.Backend = Backend
 	c.DBAddr = DBAddr
 	c.DBPort = DBPort
 	c.DBName = DBName
 	c.DBUser = DBUser
+	c.DBSSLMode = DBSSLMode
+	c.MaxOpenConns = MaxOpenConns
+	c.MaxIdleConns = MaxIdleConns
+	c.ConnMaxLifetime = ConnMaxLifetime
+	c.ConnMaxIdleTime = ConnMaxIdleTime
+	c.StatementTimeout = StatementTimeout
+	c.DBRetryWait = DBRetryWait
 	c.NATSURL = NATSURL
 	c.Subject = Subject
+	c.Queue = Queue
+	c.DrainTimeout = DrainTimeout
+	c.MaxListLimit = MaxListLimit
+	c.MaxBatchSize = MaxBatchSize
+	c.Workers = Workers
+	c.MaxPending = MaxPending
+	c.PendingMsgs = PendingMsgs
+	c.PendingBytes = PendingBytes
+	c.NATS = *natsconf.NewConfig()
+	c.Log = *logging.NewConfig()
+	c.Trace = *tracing.NewConfig()
 	return
 }
 
@@ -132,61 +256,335 @@ func NewConfig() (c *Config) {
 // The prefix argument used to prefix all the flags with the
 // given prefix. Use "prefix-" or something like that.
 func (c *Config) FromFlags(fset *flag.FlagSet, prefix string) {
-	flag.StringVar(&c.DBAddr,
+	fset.StringVar(&c.Backend,
+		prefix+"backend",
+		c.Backend,
+		"storage backend: cockroachdb or memory (for tests, not persistent)")
+	fset.StringVar(&c.DBAddr,
 		prefix+"db-addr",
 		c.DBAddr,
 		"cockroachdb server's address")
-	flag.IntVar(&c.DBPort,
+	fset.IntVar(&c.DBPort,
 		prefix+"db-port",
 		c.DBPort,
 		"cockroachdb server's port")
-	flag.StringVar(&c.DBName,
+	fset.StringVar(&c.DBName,
 		prefix+"db-name",
 		c.DBName,
 		"database name")
-	flag.StringVar(&c.DBUser,
+	fset.StringVar(&c.DBUser,
 		prefix+"db-user",
 		c.DBUser,
 		"database user name")
-	flag.StringVar(&c.NATSURL,
+	fset.StringVar(&c.DBPassword,
+		prefix+"db-password",
+		c.DBPassword,
+		"database password, insecure, use -db-password-file or "+
+			EnvPrefix+"DB_PASSWORD environment variable instead")
+	fset.StringVar(&c.DBPasswordFile,
+		prefix+"db-password-file",
+		c.DBPasswordFile,
+		"file with database password")
+	fset.StringVar(&c.DBSSLMode,
+		prefix+"db-sslmode",
+		c.DBSSLMode,
+		"database SSL mode: disable, require, verify-ca or verify-full")
+	fset.StringVar(&c.DBSSLRootCert,
+		prefix+"db-sslrootcert",
+		c.DBSSLRootCert,
+		"database CA certificate file")
+	fset.StringVar(&c.DBSSLCert,
+		prefix+"db-sslcert",
+		c.DBSSLCert,
+		"database client certificate file")
+	fset.StringVar(&c.DBSSLKey,
+		prefix+"db-sslkey",
+		c.DBSSLKey,
+		"database client key file")
+	fset.IntVar(&c.MaxOpenConns,
+		prefix+"db-max-open-conns",
+		c.MaxOpenConns,
+		"max open database connections, 0 for no limit")
+	fset.IntVar(&c.MaxIdleConns,
+		prefix+"db-max-idle-conns",
+		c.MaxIdleConns,
+		"max idle database connections, 0 for no idle connections")
+	fset.DurationVar(&c.ConnMaxLifetime,
+		prefix+"db-conn-max-lifetime",
+		c.ConnMaxLifetime,
+		"max database connection lifetime, 0 for no limit")
+	fset.DurationVar(&c.ConnMaxIdleTime,
+		prefix+"db-conn-max-idle-time",
+		c.ConnMaxIdleTime,
+		"max database connection idle time, 0 for no limit")
+	fset.DurationVar(&c.StatementTimeout,
+		prefix+"db-statement-timeout",
+		c.StatementTimeout,
+		"per-query timeout, 0 for no timeout")
+	fset.DurationVar(&c.DBRetryWait,
+		prefix+"db-retry-wait",
+		c.DBRetryWait,
+		"wait between database connection attempts on start, 0 for no retry")
+	fset.StringVar(&c.NATSURL,
 		prefix+"nats-url",
 		c.NATSURL,
 		"NATS server's url")
-	flag.StringVar(&c.Subject,
+	fset.StringVar(&c.Subject,
 		prefix+"nats-subject",
 		c.Subject,
 		"NATS subject's name")
+	fset.StringVar(&c.Queue,
+		prefix+"nats-queue",
+		c.Queue,
+		"NATS queue group name, empty for no group")
+	fset.StringVar(&c.NATSEmbedded,
+		prefix+"nats-embedded",
+		c.NATSEmbedded,
+		"start embedded NATS server on the address, e.g. 127.0.0.1:4222,"+
+			" and connect to it, for local development")
+	fset.StringVar(&c.InstanceID,
+		prefix+"instance-id",
+		c.InstanceID,
+		"instance ID in health responses, hostname-pid if empty")
+	fset.StringVar(&c.MetricsListen,
+		prefix+"metrics-listen",
+		c.MetricsListen,
+		"address and port of the /metrics HTTP listener, empty to disable")
+	c.Log.FromFlags(fset, prefix)
+	c.Trace.FromFlags(fset, prefix)
+	c.NATS.FromFlags(fset, prefix)
+	fset.DurationVar(&c.DrainTimeout,
+		prefix+"drain-timeout",
+		c.DrainTimeout,
+		"graceful shutdown timeout, max time to finish accepted requests")
+	fset.Int64Var(&c.MaxListLimit,
+		prefix+"max-list-limit",
+		c.MaxListLimit,
+		"max items per list request")
+	fset.IntVar(&c.MaxBatchSize,
+		prefix+"max-batch-size",
+		c.MaxBatchSize,
+		"max items per batch request")
+	fset.IntVar(&c.Workers,
+		prefix+"workers",
+		c.Workers,
+		"number of concurrent request handlers")
+	fset.IntVar(&c.MaxPending,
+		prefix+"max-pending",
+		c.MaxPending,
+		"max requests waiting for a handler, overloaded if exceeded")
+	fset.IntVar(&c.PendingMsgs,
+		prefix+"nats-pending-msgs",
+		c.PendingMsgs,
+		"NATS subscription pending messages limit, -1 for no limit")
+	fset.IntVar(&c.PendingBytes,
+		prefix+"nats-pending-bytes",
+		c.PendingBytes,
+		"NATS subscription pending bytes limit, -1 for no limit")
+}
+
+// Validate values of the Config.
+func (c *Config) Validate() (err error) {
+	switch c.Backend {
+	case BackendCockroachDB, BackendMemory:
+	default:
+		return fmt.Errorf("unknown storage backend: %q", c.Backend)
+	}
+	switch {
+	case c.DBAddr == "":
+		return errors.New("empty database address")
+	case !config.ValidPort(c.DBPort):
+		return fmt.Errorf("invalid database port: %d", c.DBPort)
+	case c.DBName == "":
+		return errors.New("empty database name")
+	case c.DBUser == "":
+		return errors.New("empty database user name")
+	}
+	switch c.DBSSLMode {
+	case "disable", "require", "verify-ca", "verify-full": // supported by lib/pq
+	default:
+		return fmt.Errorf("invalid database SSL mode: %q", c.DBSSLMode)
+	}
+	switch {
+	case c.MaxOpenConns < 0:
+		return fmt.Errorf("negative max open connections: %d",
+			c.MaxOpenConns)
+	case c.MaxIdleConns < 0:
+		return fmt.Errorf("negative max idle connections: %d",
+			c.MaxIdleConns)
+	case c.ConnMaxLifetime < 0:
+		return fmt.Errorf("negative connection max lifetime: %s",
+			c.ConnMaxLifetime)
+	case c.ConnMaxIdleTime < 0:
+		return fmt.Errorf("negative connection max idle time: %s",
+			c.ConnMaxIdleTime)
+	case c.StatementTimeout < 0:
+		return fmt.Errorf("negative statement timeout: %s",
+			c.StatementTimeout)
+	case c.DBRetryWait < 0:
+		return fmt.Errorf("negative database retry wait: %s", c.DBRetryWait)
+	case c.NATSURL == "":
+		return errors.New("empty NATS url")
+	case !config.ValidSubject(c.Subject):
+		return fmt.Errorf("invalid NATS subject: %q", c.Subject)
+	case c.NATSEmbedded != "" && !config.ValidAddr(c.NATSEmbedded):
+		return fmt.Errorf("invalid embedded NATS address: %q",
+			c.NATSEmbedded)
+	case c.MetricsListen != "" && !config.ValidAddr(c.MetricsListen):
+		return fmt.Errorf("invalid metrics listen address: %q",
+			c.MetricsListen)
+	case c.DrainTimeout <= 0:
+		return fmt.Errorf("invalid drain timeout: %s", c.DrainTimeout)
+	case c.MaxListLimit <= 0:
+		return fmt.Errorf("invalid max list limit: %d", c.MaxListLimit)
+	case c.MaxBatchSize <= 0:
+		return fmt.Errorf("invalid max batch size: %d", c.MaxBatchSize)
+	case c.Workers <= 0:
+		return fmt.Errorf("invalid number of workers: %d", c.Workers)
+	case c.MaxPending < 0:
+		return fmt.Errorf("negative max pending: %d", c.MaxPending)
+	case c.PendingMsgs == 0 || c.PendingMsgs < -1:
+		return fmt.Errorf("invalid NATS pending messages limit: %d",
+			c.PendingMsgs)
+	case c.PendingBytes == 0 || c.PendingBytes < -1:
+		return fmt.Errorf("invalid NATS pending bytes limit: %d",
+			c.PendingBytes)
+	}
+	if err = c.NATS.Validate(); err != nil {
+		return
+	}
+	return c.Trace.Validate()
+}
+
+// LoadDBPassword sets the DBPassword from the DBPasswordFile if the
+// DBPassword is empty. Thus the DBPassword overrides the file. The
+// DBPassword and the DBPasswordFile can be set by the flags, by
+// environment variables of the EnvPrefix, e.g. NEWS_STORAGE_DB_PASSWORD,
+// or by a config file. Trailing new line of the file is ignored.
+func (c *Config) LoadDBPassword() (err error) {
+	if c.DBPassword != "" {
+		return
+	}
+	if c.DBPasswordFile != "" {
+		var pass []byte
+		if pass, err = os.ReadFile(c.DBPasswordFile); err != nil {
+			return fmt.Errorf("reading database password: %w", err)
+		}
+		c.DBPassword = strings.TrimRight(string(pass), "\r\n")
+	}
+	return
 }
 
 // OpenDBURL based on values of the Config.
 func (c *Config) OpenDBURL() string {
-	return fmt.Sprintf("postgresql://%s@%s:%d/%s?sslmode=disable",
-		c.DBUser, c.DBAddr, c.DBPort, c.DBName)
+	var u = url.URL{
+		Scheme: "postgresql",
+		Host:   net.JoinHostPort(c.DBAddr, strconv.Itoa(c.DBPort)),
+		Path:   "/" + c.DBName,
+	}
+	if c.DBPassword != "" {
+		u.User = url.UserPassword(c.DBUser, c.DBPassword)
+	} else {
+		u.User = url.User(c.DBUser)
+	}
+	var q = url.Values{}
+	q.Set("sslmode", c.DBSSLMode)
+	for key, val := range map[string]string{
+		"sslrootcert": c.DBSSLRootCert,
+		"sslcert":     c.DBSSLCert,
+		"sslkey":      c.DBSSLKey,
+	} {
+		if val != "" {
+			q.Set(key, val)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
 }
 
 type DB struct {
 	DB *sql.DB // undelying SQL databse instance
+
+	name          string                   // database name
+	stmtTimeout   time.Duration            // per-query timeout
+	queryDuration *prometheus.HistogramVec // query latency
 }
 
-// NewDB creates new conented DB instance.
+// NewDB creates new conented DB instance. It configures the
+// connections pool and pings the database, thus a bad DSN or
+// unreachable database fails here.
 func NewDB(conf *Config) (db *DB, err error) {
+	if err = conf.LoadDBPassword(); err != nil {
+		return
+	}
 	db = new(DB)
-	db.DB, err = sql.Open("postgres", conf.OpenDBURL())
-	// TODO (kostyarin): configure db: max idle, max open, lifetime, etc
-	//                   using hardcoded values, or keeping the values in
-	//                   the Config
+	if db.DB, err = sql.Open("postgres", conf.OpenDBURL()); err != nil {
+		return nil, err
+	}
+	db.DB.SetMaxOpenConns(conf.MaxOpenConns)
+	db.DB.SetMaxIdleConns(conf.MaxIdleConns)
+	db.DB.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	db.DB.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+	db.name = conf.DBName
+	db.stmtTimeout = conf.StatementTimeout
+	db.queryDuration = newQueryDuration()
+
+	var ctx, cancel = db.stmtContext(context.Background())
+	defer cancel()
+
+	if err = db.DB.PingContext(ctx); err != nil {
+		db.DB.Close()
+		return nil, fmt.Errorf("pinging database: %w", err)
+	}
 	return
 }
 
-// Init database creating table if it doesn't exist
+// stmtContext returns context of one query limited by
+// the statement timeout.
+func (db *DB) stmtContext(
+	parent context.Context,
+) (
+	ctx context.Context,
+	cancel context.CancelFunc,
+) {
+	if db.stmtTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, db.stmtTimeout)
+}
+
+// ConnectDB creates new DB and initializes it. If the database is
+// unavailable it retries every conf.DBRetryWait until the ctx
+// canceled. Other errors, like wrong credentials, are returned
+// immediately.
+func ConnectDB(ctx *Context, conf *Config) (db *DB, err error) {
+	for {
+		if db, err = NewDB(conf); err == nil {
+			if err = db.Init(ctx); err == nil {
+				return
+			}
+			db.Close()
+		}
+		if !Temporary(err) || conf.DBRetryWait <= 0 {
+			return nil, err
+		}
+		slog.Warn("database unavailable", "error", err,
+			"retry_in", conf.DBRetryWait.String())
+		select {
+		case <-ctx.Ctx.Done():
+			return nil, ctx.Ctx.Err()
+		case <-time.After(conf.DBRetryWait):
+		}
+	}
+}
+
+// Init database migrating its schema to the latest version.
 func (db *DB) Init(ctx *Context) (err error) {
-	const createTable = `CREATE TABLE IF NOT EXISTS ` + tableName + ` (
-		id     SERIAL PRIMARY KEY,
-		header VARCHAR(255),
-		data   TEXT
-	)`
-	_, err = db.DB.ExecContext(ctx.Ctx, createTable)
-	return
+	var m *migrations.Migrator
+	if m, err = migrations.New(db.DB); err != nil {
+		return
+	}
+	return m.Up(ctx.Ctx)
 }
 
 // Select news item by id. It returns sql.ErrNoRows if
@@ -199,10 +597,24 @@ func (db *DB) Select(
 	err error,
 ) {
 
-	const selectNewsItem = `SELECT * FROM ` + tableName + ` WHERE id = $1`
+	const selectNewsItem = `SELECT id, header, data FROM ` + tableName + `
+		WHERE id = $1`
+
+	defer db.observe("select", time.Now())
+	var sctx, span = tracer().Start(ctx.Ctx, "select",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "cockroachdb"),
+			attribute.String("db.operation.name", "SELECT"),
+			attribute.String("db.collection.name", tableName),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+	var qctx, cancel = db.stmtContext(sctx)
+	defer cancel()
 
 	ni = new(msg.NewsItem)
-	err = db.DB.QueryRowContext(ctx.Ctx, selectNewsItem, id).Scan(
+	err = db.DB.QueryRowContext(qctx, selectNewsItem, id).Scan(
 		&ni.ID,
 		&ni.Header,
 		&ni.Data,
@@ -210,6 +622,167 @@ func (db *DB) Select(
 	return
 }
 
+// SelectMany news items by ids using one query. Order of
+// returned items is undefined, missing items are skipped.
+func (db *DB) SelectMany(
+	ctx *Context,
+	ids []int64,
+) (
+	items []*msg.NewsItem,
+	err error,
+) {
+
+	const selectNewsItems = `SELECT id, header, data FROM ` + tableName + `
+		WHERE id = ANY($1)`
+
+	defer db.observe("select_many", time.Now())
+	var qctx, cancel = db.stmtContext(ctx.Ctx)
+	defer cancel()
+
+	var rows *sql.Rows
+	rows, err = db.DB.QueryContext(qctx, selectNewsItems, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ni = new(msg.NewsItem)
+		if err = rows.Scan(&ni.ID, &ni.Header, &ni.Data); err != nil {
+			return nil, err
+		}
+		items = append(items, ni)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// List news items with id greater than the after ordered by id.
+// The limit is max number of items to return.
+func (db *DB) List(
+	ctx *Context,
+	after int64,
+	limit int64,
+) (
+	items []*msg.NewsItem,
+	err error,
+) {
+
+	const listNewsItems = `SELECT id, header, data FROM ` + tableName + `
+		WHERE id > $1 ORDER BY id LIMIT $2`
+
+	defer db.observe("list", time.Now())
+	var qctx, cancel = db.stmtContext(ctx.Ctx)
+	defer cancel()
+
+	var rows *sql.Rows
+	if rows, err = db.DB.QueryContext(qctx, listNewsItems, after, limit); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ni = new(msg.NewsItem)
+		if err = rows.Scan(&ni.ID, &ni.Header, &ni.Data); err != nil {
+			return nil, err
+		}
+		items = append(items, ni)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Insert news item. The ID of the given item is ignored. It returns
+// new item with ID.
+func (db *DB) Insert(
+	ctx *Context,
+	ni *msg.NewsItem,
+) (
+	ins *msg.NewsItem,
+	err error,
+) {
+
+	const insertNewsItem = `INSERT INTO ` + tableName + ` (header, data)
+		VALUES ($1, $2) RETURNING id`
+
+	defer db.observe("insert", time.Now())
+	var qctx, cancel = db.stmtContext(ctx.Ctx)
+	defer cancel()
+
+	ins = new(msg.NewsItem)
+	ins.Header, ins.Data = ni.Header, ni.Data
+	err = db.DB.QueryRowContext(qctx, insertNewsItem,
+		ni.Header,
+		ni.Data,
+	).Scan(&ins.ID)
+	return
+}
+
+// Update header and data of news item by its id. It returns
+// sql.ErrNoRows if the item doesn't exist.
+func (db *DB) Update(ctx *Context, ni *msg.NewsItem) (err error) {
+
+	const updateNewsItem = `UPDATE ` + tableName + `
+		SET header = $2, data = $3 WHERE id = $1`
+
+	defer db.observe("update", time.Now())
+	var qctx, cancel = db.stmtContext(ctx.Ctx)
+	defer cancel()
+
+	var res sql.Result
+	res, err = db.DB.ExecContext(qctx, updateNewsItem,
+		ni.ID,
+		ni.Header,
+		ni.Data,
+	)
+	if err != nil {
+		return
+	}
+	return affected(res)
+}
+
+// Delete news item by id. It returns sql.ErrNoRows if the
+// item doesn't exist.
+func (db *DB) Delete(ctx *Context, id int64) (err error) {
+
+	const deleteNewsItem = `DELETE FROM ` + tableName + ` WHERE id = $1`
+
+	defer db.observe("delete", time.Now())
+	var qctx, cancel = db.stmtContext(ctx.Ctx)
+	defer cancel()
+
+	var res sql.Result
+	if res, err = db.DB.ExecContext(qctx, deleteNewsItem, id); err != nil {
+		return
+	}
+	return affected(res)
+}
+
+// affected returns sql.ErrNoRows if no rows affected.
+func affected(res sql.Result) (err error) {
+	var n int64
+	if n, err = res.RowsAffected(); err != nil {
+		return
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return
+}
+
+// Ping the database.
+func (db *DB) Ping(ctx *Context) error {
+	defer db.observe("ping", time.Now())
+	var qctx, cancel = db.stmtContext(ctx.Ctx)
+	defer cancel()
+
+	return db.DB.PingContext(qctx)
+}
+
 // Close the DB.
 func (db *DB) Close() error {
 	return db.DB.Close()
@@ -217,63 +790,594 @@ func (db *DB) Close() error {
 
 // The QQ represents NATS conenction and processor
 type QQ struct {
-	Conn *nats.Conn         // connection
-	Subs *nats.Subscription // subscription
+	stats    Stats // first for atomic alignment
+	inFlight int64 // accepted requests not finished yet
+
+	Conn *nats.Conn           // connection
+	Subs []*nats.Subscription // subscriptions
+
+	mx     sync.RWMutex   // lock jobs
+	closed bool           // jobs closed
+	jobs   chan job       // pending requests
+	wg     sync.WaitGroup // workers
+
+	direct map[string]*handler // by subject, see the NewDirect
+
+	ctx          *Context      // service context, parent of requests
+	drainTimeout time.Duration // graceful shutdown timeout
+
+	instance string     // instance ID
+	started  time.Time  // start time
+	metrics  *qqMetrics // nil for no metrics
 }
 
-// NewQQ creates new connected, subscribed and handled.
-func NewQQ(ctx *Context, conf *Config, db *DB) (qq *QQ, err error) {
-	qq = new(QQ)
-	if qq.Conn, err = nats.Connect(conf.NATSURL); err != nil {
-		return nil, fmt.Errorf("conencting NATS: %v", err)
+// Stats of failures of the QQ. A failure doesn't stop the QQ.
+type Stats struct {
+	DecodeErrors uint64 // malformed requests
+	EncodeErrors uint64 // responses failed to encode
+	ReplyErrors  uint64 // responses failed to send
+	Panics       uint64 // recovered panics of handlers
+	Disconnects  uint64 // NATS connection lost
+	Reconnects   uint64 // NATS connection restored
+}
+
+// a job is pending request with its handler and deadline
+type job struct {
+	req      *nats.Msg
+	h        *handler
+	deadline time.Time // zero for no deadline
+}
+
+// a handler of a subject, the handle returns response for given
+// request using the request context, the failure creates error
+// response of the subject's response type
+type handler struct {
+	subject string
+	handle  func(ctx *Context, req *nats.Msg) (rsp proto.Message)
+	failure func(code msg.Code, detail string) proto.Message
+}
+
+// itemFailure creates msg.Response with given error.
+func itemFailure(code msg.Code, detail string) proto.Message {
+	return &msg.Response{Code: code, Error: detail}
+}
+
+// listFailure creates msg.ListResponse with given error.
+func listFailure(code msg.Code, detail string) proto.Message {
+	return &msg.ListResponse{Code: code, Error: detail}
+}
+
+// batchFailure creates msg.BatchResponse with given error.
+func batchFailure(code msg.Code, detail string) proto.Message {
+	return &msg.BatchResponse{Code: code, Error: detail}
+}
+
+// NewQQ creates new connected, subscribed and handled. Requests
+// are handled by the conf.Workers goroutines using the store.
+func NewQQ(ctx *Context, conf *Config, store Store) (qq *QQ, err error) {
+	if conf.Workers <= 0 {
+		return nil, fmt.Errorf("invalid number of workers: %d", conf.Workers)
+	}
+	qq = newQQ(ctx, conf)
+	var opts []nats.Option
+	if opts, err = conf.NATS.Options(); err != nil {
+		return nil, err
 	}
-	qq.Subs, err = qq.Conn.Subscribe(
-		conf.Subject, // strings.Replace(conf.Subject, "_", ".", -1)
-		qq.handler(ctx, db),
+	opts = append(opts, natsconf.Handlers(qq.connState(ctx))...)
+	qq.Conn, err = nats.Connect(conf.NATSURL,
+		append(opts, nats.DrainTimeout(conf.DrainTimeout))...,
 	)
 	if err != nil {
-		qq.Conn.Close()
-		return nil, fmt.Errorf("subscribing '%s' subject: %v", conf.Subject, err)
+		return nil, fmt.Errorf("conencting NATS: %v", err)
+	}
+	qq.jobs = make(chan job, conf.MaxPending)
+	for i := 0; i < conf.Workers; i++ {
+		qq.wg.Add(1)
+		go qq.worker()
+	}
+	var handlers, health = qq.handlers(conf, store)
+	for _, h := range handlers {
+		var subs *nats.Subscription
+		subs, err = qq.Conn.QueueSubscribe(
+			h.subject, // strings.Replace(conf.Subject, "_", ".", -1)
+			conf.Queue,
+			qq.dispatch(h),
+		)
+		if err == nil {
+			err = subs.SetPendingLimits(conf.PendingMsgs, conf.PendingBytes)
+		}
+		if err != nil {
+			qq.Close()
+			return nil, fmt.Errorf("subscribing '%s' subject: %v", h.subject, err)
+		}
+		qq.Subs = append(qq.Subs, subs)
+	}
+	// every instance answers health requests, thus no queue group and
+	// no workers pool, it works even if the QQ is overloaded
+	var subs *nats.Subscription
+	subs, err = qq.Conn.Subscribe(health.subject, func(req *nats.Msg) {
+		qq.serve(req, health, requestDeadline(req))
+	})
+	if err != nil {
+		qq.Close()
+		return nil, fmt.Errorf("subscribing '%s' subject: %v",
+			health.subject, err)
+	}
+	qq.Subs = append(qq.Subs, subs)
+	return
+}
+
+// newQQ without connection and workers
+func newQQ(ctx *Context, conf *Config) (qq *QQ) {
+	qq = new(QQ)
+	qq.ctx = ctx
+	qq.drainTimeout = conf.DrainTimeout
+	qq.instance, qq.started = conf.InstanceID, time.Now()
+	qq.metrics = newQQMetrics()
+	if qq.instance == "" {
+		qq.instance = defaultInstanceID()
 	}
 	return
 }
 
-// handler for requests.
-func (qq *QQ) handler(ctx *Context, db *DB) func(req *nats.Msg) {
+// handlers of subjects of the conf.Subject using the store, and
+// handler of the health subject
+func (qq *QQ) handlers(
+	conf *Config,
+	store Store,
+) (
+	handlers []*handler,
+	health *handler,
+) {
+	handlers = []*handler{
+		{conf.Subject, qq.handler(store), itemFailure},
+		{conf.Subject + msg.InsertSuffix, qq.insertHandler(store), itemFailure},
+		{conf.Subject + msg.UpdateSuffix, qq.updateHandler(store), itemFailure},
+		{conf.Subject + msg.DeleteSuffix, qq.deleteHandler(store), itemFailure},
+		{conf.Subject + msg.ListSuffix, qq.listHandler(conf, store), listFailure},
+		{conf.Subject + msg.BatchSuffix, qq.batchHandler(conf, store), batchFailure},
+	}
+	health = &handler{
+		conf.Subject + msg.HealthSuffix,
+		qq.healthHandler(store),
+		healthFailure,
+	}
+	return
+}
+
+// Stats returns current failure counters.
+func (qq *QQ) Stats() (stats Stats) {
+	stats.DecodeErrors = atomic.LoadUint64(&qq.stats.DecodeErrors)
+	stats.EncodeErrors = atomic.LoadUint64(&qq.stats.EncodeErrors)
+	stats.ReplyErrors = atomic.LoadUint64(&qq.stats.ReplyErrors)
+	stats.Panics = atomic.LoadUint64(&qq.stats.Panics)
+	stats.Disconnects = atomic.LoadUint64(&qq.stats.Disconnects)
+	stats.Reconnects = atomic.LoadUint64(&qq.stats.Reconnects)
+	return
+}
+
+// connState counts NATS connection state changes. It terminates the
+// ctx if the connection closed not by the Close, e.g. if all reconnect
+// attempts failed. Until that the QQ keeps working in degraded mode.
+func (qq *QQ) connState(ctx *Context) func(*nats.Conn, nats.Status) {
+	return func(_ *nats.Conn, status nats.Status) {
+		switch status {
+		case nats.DISCONNECTED:
+			atomic.AddUint64(&qq.stats.Disconnects, 1)
+		case nats.CONNECTED:
+			atomic.AddUint64(&qq.stats.Reconnects, 1)
+		case nats.CLOSED:
+			qq.mx.RLock()
+			defer qq.mx.RUnlock()
+			if !qq.closed {
+				ctx.Terminatef("NATS connection closed: reconnection failed")
+			}
+		}
+	}
+}
+
+// worker handles pending requests until the jobs closed.
+func (qq *QQ) worker() {
+	defer qq.wg.Done()
+	for j := range qq.jobs {
+		qq.serve(j.req, j.h, j.deadline)
+		atomic.AddInt64(&qq.inFlight, -1)
+	}
+}
+
+// requestDeadline returns deadline of the request from its
+// msg.TimeoutHeader, or zero time if the request has no deadline.
+func requestDeadline(req *nats.Msg) (deadline time.Time) {
+	var val = req.Header.Get(msg.TimeoutHeader)
+	if val == "" {
+		return
+	}
+	ms, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || ms <= 0 {
+		return // ignore malformed header
+	}
+	return time.Now().Add(time.Duration(ms) * time.Millisecond)
+}
+
+// requestContext returns context of a request limited by given
+// deadline, if any, and canceled with the service context or with
+// the caller context.
+func (qq *QQ) requestContext(
+	caller context.Context,
+	deadline time.Time,
+) (
+	ctx *Context,
+	cancel context.CancelFunc,
+) {
+	var parent = qq.ctx
+	if parent == nil {
+		parent = &Context{Ctx: context.Background()}
+	}
+	var rctx context.Context
+	if deadline.IsZero() {
+		rctx, cancel = context.WithCancel(parent.Ctx)
+	} else {
+		rctx, cancel = context.WithDeadline(parent.Ctx, deadline)
+	}
+	if caller.Done() != nil {
+		var stop = context.AfterFunc(caller, cancel)
+		var cancelRequest = cancel
+		cancel = func() {
+			stop()
+			cancelRequest()
+		}
+	}
+	return parent.WithContext(rctx), cancel
+}
+
+// serve the request and respond.
+func (qq *QQ) serve(req *nats.Msg, h *handler, deadline time.Time) {
+	qq.respond(req, h, qq.process(context.Background(), req, h, deadline))
+}
+
+// process the request recovering a panic of the handler. A request
+// already expired, e.g. while waiting for a worker, is not handled.
+// The request is canceled with the caller context.
+func (qq *QQ) process(
+	caller context.Context,
+	req *nats.Msg,
+	h *handler,
+	deadline time.Time,
+) (
+	rsp proto.Message,
+) {
+	var start = time.Now()
+	var ctx, cancel = qq.requestContext(caller, deadline)
+	defer cancel()
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				atomic.AddUint64(&qq.stats.Panics, 1)
+				qq.logger(req).Error("handler panic", "panic", fmt.Sprint(p),
+					"stack", string(debug.Stack()))
+				rsp = h.failure(msg.Code_INTERNAL, fmt.Sprint("panic: ", p))
+			}
+		}()
+		if err := ctx.Ctx.Err(); err != nil {
+			qq.logger(req).Debug("request skipped", "error", err)
+			rsp = h.failure(errorCode(err), "skipped: "+err.Error())
+			return
+		}
+		rsp = h.handle(ctx, req)
+	}()
+	var code = responseCode(rsp)
+	qq.observe(h.subject, code, start)
+	qq.logger(req).Debug("request handled", "code", code.String(),
+		"duration_ms", float64(time.Since(start))/float64(time.Millisecond))
+	return
+}
+
+// logger of the request, with its subject and request ID
+func (qq *QQ) logger(req *nats.Msg) *slog.Logger {
+	return logging.With(req.Header.Get(logging.RequestIDHeader)).
+		With("subject", req.Subject)
+}
+
+// dispatch returns NATS handler that sends requests to workers.
+// If the pending queue is full, then it responds with the
+// RESOURCE_EXHAUSTED code immediately.
+func (qq *QQ) dispatch(h *handler) nats.MsgHandler {
 	return func(req *nats.Msg) {
+		qq.mx.RLock()
+		defer qq.mx.RUnlock()
+		if qq.closed {
+			return // the requester gets timeout or no responders error
+		}
+		// before the send, a worker can finish the job before
+		// the send returns
+		atomic.AddInt64(&qq.inFlight, 1)
+		select {
+		case qq.jobs <- job{req, h, requestDeadline(req)}:
+		default:
+			atomic.AddInt64(&qq.inFlight, -1)
+			qq.observe(h.subject, msg.Code_RESOURCE_EXHAUSTED, time.Time{})
+			qq.logger(req).Debug("overloaded, request rejected")
+			qq.respond(req, h, h.failure(msg.Code_RESOURCE_EXHAUSTED,
+				"overloaded"))
+		}
+	}
+}
+
+// decode request, it returns error response of the failure
+// if the request is malformed, or nil.
+func (qq *QQ) decode(
+	req *nats.Msg,
+	pb proto.Message,
+	failure func(code msg.Code, detail string) proto.Message,
+) (
+	rsp proto.Message,
+) {
+	if err := proto.Unmarshal(req.Data, pb); err != nil {
+		atomic.AddUint64(&qq.stats.DecodeErrors, 1)
+		qq.logger(req).Warn("malformed request", "error", err)
+		return failure(msg.Code_INVALID_ARGUMENT, "malformed request: "+
+			err.Error())
+	}
+	return nil
+}
+
+// encode response to given request, replacing it with error response
+// if it can't be encoded. A failure is logged and counted.
+func (qq *QQ) encode(
+	req *nats.Msg,
+	h *handler,
+	rsp proto.Message,
+) (
+	val []byte,
+	err error,
+) {
+	if val, err = proto.Marshal(rsp); err != nil {
+		atomic.AddUint64(&qq.stats.EncodeErrors, 1)
+		qq.logger(req).Error("encoding response", "error", err)
+		rsp = h.failure(msg.Code_INTERNAL, "encoding response: "+err.Error())
+		val, err = proto.Marshal(rsp)
+	}
+	return
+}
+
+// respond to given request. A failure is logged and counted.
+func (qq *QQ) respond(req *nats.Msg, h *handler, rsp proto.Message) {
+	val, err := qq.encode(req, h, rsp)
+	if err != nil {
+		return // the requester gets timeout
+	}
+	if err = req.Respond(val); err != nil {
+		// the requester can't get the response, e.g. if the
+		// request is not a request (has no reply subject),
+		// or the NATS connection is closed
+		atomic.AddUint64(&qq.stats.ReplyErrors, 1)
+		qq.logger(req).Warn("responding request", "error", err)
+	}
+}
+
+// handler for requests. It continues trace of the request.
+func (qq *QQ) handler(store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
 		var (
-			id  msg.ID
+			rsp msg.Response
 			err error
 		)
-		if err = proto.Unmarshal(req.Data, &id); err != nil {
-			// should never happen
-			ctx.Terminatef("[FATAL] NATS decoding received message: %v", err)
-			return
+		var rctx, span = tracer().Start(tracing.Extract(ctx.Ctx, req),
+			req.Subject,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "nats"),
+				attribute.String("messaging.destination.name", req.Subject),
+			),
+		)
+		defer func() { tracing.End(span, err) }()
+
+		var id msg.ID
+		if fail := qq.decode(req, &id, itemFailure); fail != nil {
+			span.SetStatus(codes.Error, "malformed request")
+			return fail
+		}
+		span.SetAttributes(attribute.Int64("news.id", id.ID))
+		if rsp.Item, err = store.Select(ctx.WithContext(rctx), id.ID); err != nil {
+			rsp.Item = nil
+			rsp.Code, rsp.Error = errorCode(err), err.Error()
+		}
+		return &rsp
+	}
+}
+
+// insertHandler for insert requests.
+func (qq *QQ) insertHandler(store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
+		var ins msg.InsertRequest
+		if fail := qq.decode(req, &ins, itemFailure); fail != nil {
+			return fail
+		}
+		var (
+			rsp msg.Response
+			err error
+		)
+		if ins.Item == nil {
+			rsp.Code, rsp.Error = msg.Code_INVALID_ARGUMENT, "missing item"
+		} else if rsp.Item, err = store.Insert(ctx, ins.Item); err != nil {
+			rsp.Item = nil
+			rsp.Code, rsp.Error = errorCode(err), err.Error()
+		}
+		return &rsp
+	}
+}
+
+// updateHandler for update requests.
+func (qq *QQ) updateHandler(store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
+		var upd msg.UpdateRequest
+		if fail := qq.decode(req, &upd, itemFailure); fail != nil {
+			return fail
 		}
-		var ni *msg.NewsItem
-		ni, err = db.Select(ctx, id.ID)
 		var rsp msg.Response
-		rsp.Item = ni
-		if err != nil {
-			rsp.Error = err.Error()
+		if upd.Item == nil {
+			rsp.Code, rsp.Error = msg.Code_INVALID_ARGUMENT, "missing item"
+		} else if err := store.Update(ctx, upd.Item); err != nil {
+			rsp.Code, rsp.Error = errorCode(err), err.Error()
+		} else {
+			rsp.Item = upd.Item
 		}
-		val, err := proto.Marshal(&rsp)
+		return &rsp
+	}
+}
+
+// deleteHandler for delete requests.
+func (qq *QQ) deleteHandler(store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
+		var del msg.DeleteRequest
+		if fail := qq.decode(req, &del, itemFailure); fail != nil {
+			return fail
+		}
+		var rsp msg.Response
+		if err := store.Delete(ctx, del.ID); err != nil {
+			rsp.Code, rsp.Error = errorCode(err), err.Error()
+		}
+		return &rsp
+	}
+}
+
+// listHandler for list requests.
+func (qq *QQ) listHandler(conf *Config, store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
+		var list msg.ListRequest
+		if fail := qq.decode(req, &list, listFailure); fail != nil {
+			return fail
+		}
+		if list.Limit <= 0 || list.Limit > conf.MaxListLimit {
+			list.Limit = conf.MaxListLimit
+		}
+		var (
+			rsp msg.ListResponse
+			err error
+		)
+		if rsp.Items, err = store.List(ctx, list.After, list.Limit); err != nil {
+			rsp.Code, rsp.Error = errorCode(err), err.Error()
+		} else if int64(len(rsp.Items)) == list.Limit {
+			rsp.Next = rsp.Items[len(rsp.Items)-1].ID // can be more
+		}
+		return &rsp
+	}
+}
+
+// batchHandler for batch requests.
+func (qq *QQ) batchHandler(conf *Config, store Store) func(ctx *Context, req *nats.Msg) proto.Message {
+	return func(ctx *Context, req *nats.Msg) proto.Message {
+		var batch msg.BatchRequest
+		if fail := qq.decode(req, &batch, batchFailure); fail != nil {
+			return fail
+		}
+		var rsp msg.BatchResponse
+		if len(batch.IDs) > conf.MaxBatchSize {
+			rsp.Code = msg.Code_INVALID_ARGUMENT
+			rsp.Error = fmt.Sprintf("too many IDs: %d, max %d",
+				len(batch.IDs), conf.MaxBatchSize)
+			return &rsp
+		}
+		items, err := store.SelectMany(ctx, batch.IDs)
 		if err != nil {
-			// must never happen
-			panic("encoding msg.Response: " + err.Error())
+			rsp.Code, rsp.Error = errorCode(err), err.Error()
+			return &rsp
 		}
-		if err = req.Respond(val); err != nil {
-			// TODO (kostyarin): 1. do all this errors fatal?
-			//                   2. what happens where the requester disappears
-			ctx.Terminatef("[FATAL] NATS respnding message: %v", err)
-			return
+		var found = make(map[int64]*msg.NewsItem, len(items))
+		for _, ni := range items {
+			found[ni.ID] = ni
+		}
+		// in order of the request
+		for _, id := range batch.IDs {
+			if ni, ok := found[id]; ok {
+				rsp.Items = append(rsp.Items, ni)
+				continue
+			}
+			rsp.Errors = append(rsp.Errors, &msg.BatchError{
+				ID:    id,
+				Error: sql.ErrNoRows.Error(),
+				Code:  msg.Code_NOT_FOUND,
+			})
 		}
+		return &rsp
 	}
 }
 
-// Close the QQ.
+// Close the QQ gracefully. It stops receiving new requests, waits
+// for accepted requests, sends all responses and closes the NATS
+// connection, if any. All this takes conf.DrainTimeout at most. During
+// NATS outage it only waits for accepted requests, their responses
+// can't be sent anyway.
 func (qq *QQ) Close() (err error) {
-	err = qq.Subs.Unsubscribe()
-	qq.Conn.Close() // no error herer
+	var deadline = time.Now().Add(qq.drainTimeout)
+
+	// during NATS outage, e.g. reconnecting, draining can't finish
+	// and responses can't be sent, thus don't wait for it
+	var connected = qq.Conn != nil && qq.Conn.IsConnected()
+	if qq.Conn != nil && !connected {
+		slog.Warn("closing while NATS is disconnected, " +
+			"responses to accepted requests are lost")
+	}
+
+	// 1. stop receiving and wait for received
+	var drained = connected
+	for _, subs := range qq.Subs {
+		if !connected {
+			subs.Unsubscribe()
+			continue
+		}
+		if derr := subs.Drain(); derr != nil {
+			drained = false
+			if err == nil {
+				err = derr
+			}
+		}
+	}
+	for _, subs := range qq.Subs {
+		for drained && subs.IsValid() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// 2. wait for accepted requests
+	qq.mx.Lock()
+	if !qq.closed {
+		qq.closed = true
+		if qq.jobs != nil {
+			close(qq.jobs) // stop workers
+		}
+	}
+	qq.mx.Unlock()
+
+	var done = make(chan struct{})
+	go func() {
+		qq.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Until(deadline)):
+		slog.Warn("drain timeout, some requests are not finished")
+	}
+
+	// 3. flush responses and close
+	if qq.Conn == nil {
+		return // direct, see the NewDirect
+	}
+	if !connected {
+		qq.Conn.Close()
+		return
+	}
+	if derr := qq.Conn.Drain(); derr != nil {
+		qq.Conn.Close()
+		if err == nil {
+			err = derr
+		}
+		return
+	}
+	for !qq.Conn.IsClosed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	qq.Conn.Close() // no error here
 	return
 }
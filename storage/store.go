@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// storage backends
+const (
+	BackendCockroachDB = "cockroachdb" // the DB
+	BackendMemory      = "memory"      // the MemStore
+)
+
+// A Store of news items used by the QQ. Methods return sql.ErrNoRows
+// if a requested item doesn't exist, and an error of the ctx if it's
+// canceled or expired. The DB and the MemStore are Stores.
+type Store interface {
+	// Select news item by id.
+	Select(ctx *Context, id int64) (ni *msg.NewsItem, err error)
+	// SelectMany news items by ids, missing items are skipped and
+	// order of returned items is undefined.
+	SelectMany(ctx *Context, ids []int64) (items []*msg.NewsItem, err error)
+	// List news items with id greater than the after ordered by id,
+	// the limit is max number of items to return.
+	List(ctx *Context, after, limit int64) (items []*msg.NewsItem, err error)
+	// Insert news item ignoring its ID, it returns new item with ID.
+	Insert(ctx *Context, ni *msg.NewsItem) (ins *msg.NewsItem, err error)
+	// Update header and data of news item by its id.
+	Update(ctx *Context, ni *msg.NewsItem) (err error)
+	// Delete news item by id.
+	Delete(ctx *Context, id int64) (err error)
+	// Ping checks the Store is available.
+	Ping(ctx *Context) (err error)
+	// Close the Store.
+	Close() (err error)
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemStore)(nil)
+)
+
+// OpenStore of the conf.Backend with its metrics collectors. It waits
+// for the DB if it's unavailable (see the ConnectDB), a signal of the
+// stop stops the waiting and the signaled is true in this case.
+func OpenStore(
+	conf *Config,
+	stop <-chan os.Signal,
+) (
+	store Store,
+	cs []prometheus.Collector,
+	signaled bool,
+	err error,
+) {
+
+	if conf.Backend == BackendMemory {
+		slog.Warn("in-memory storage backend, news items are not persistent")
+		return NewMemStore(), nil, false, nil
+	}
+
+	var (
+		start = NewContext()
+		done  = make(chan bool, 1)
+	)
+	go func() {
+		select {
+		case sig := <-stop:
+			slog.Info("got signal, exiting...", "signal", sig.String())
+			start.Cancel()
+			done <- true
+		case <-start.Ctx.Done():
+			done <- false
+		}
+	}()
+
+	db, err := ConnectDB(start, conf)
+	start.Cancel()
+	if signaled = <-done; signaled || err != nil {
+		if err == nil {
+			db.Close()
+		}
+		return nil, nil, signaled, err
+	}
+	return db, db.Collectors(), false, nil
+}
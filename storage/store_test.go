@@ -0,0 +1,234 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"github.com/logrusorgru/news_micro_storage_system/msg"
+)
+
+// fakeStore is the MemStore that fails with the err if it's set
+type fakeStore struct {
+	*MemStore
+	err error
+}
+
+func (fs *fakeStore) Select(ctx *Context, id int64) (*msg.NewsItem, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	return fs.MemStore.Select(ctx, id)
+}
+
+func (fs *fakeStore) SelectMany(
+	ctx *Context,
+	ids []int64,
+) (
+	[]*msg.NewsItem,
+	error,
+) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	return fs.MemStore.SelectMany(ctx, ids)
+}
+
+func (fs *fakeStore) List(
+	ctx *Context,
+	after, limit int64,
+) (
+	[]*msg.NewsItem,
+	error,
+) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	return fs.MemStore.List(ctx, after, limit)
+}
+
+func (fs *fakeStore) Insert(
+	ctx *Context,
+	ni *msg.NewsItem,
+) (
+	*msg.NewsItem,
+	error,
+) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	return fs.MemStore.Insert(ctx, ni)
+}
+
+func (fs *fakeStore) Update(ctx *Context, ni *msg.NewsItem) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	return fs.MemStore.Update(ctx, ni)
+}
+
+func (fs *fakeStore) Delete(ctx *Context, id int64) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	return fs.MemStore.Delete(ctx, id)
+}
+
+func (fs *fakeStore) Ping(ctx *Context) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	return fs.MemStore.Ping(ctx)
+}
+
+func TestQQ_handlers_errors(t *testing.T) {
+	// store errors of all handlers
+
+	var (
+		ctx   = NewContext()
+		ms, _ = testMemStore(t)
+		store = &fakeStore{MemStore: ms}
+		qq    = new(QQ)
+		conf  = testConf
+	)
+	defer ctx.Cancel()
+
+	var handlers = map[string]struct {
+		handle func(ctx *Context, req *nats.Msg) proto.Message
+		req    proto.Message
+	}{
+		"get":    {qq.handler(store), &msg.ID{ID: 1}},
+		"insert": {qq.insertHandler(store), &msg.InsertRequest{Item: &msg.NewsItem{}}},
+		"update": {qq.updateHandler(store), &msg.UpdateRequest{Item: &msg.NewsItem{ID: 1}}},
+		"delete": {qq.deleteHandler(store), &msg.DeleteRequest{ID: 1}},
+		"list":   {qq.listHandler(&conf, store), &msg.ListRequest{}},
+		"batch":  {qq.batchHandler(&conf, store), &msg.BatchRequest{IDs: []int64{1}}},
+	}
+
+	for _, tt := range []struct {
+		err  error
+		code msg.Code
+	}{
+		{driver.ErrBadConn, msg.Code_UNAVAILABLE},
+		{context.DeadlineExceeded, msg.Code_DEADLINE_EXCEEDED},
+		{context.Canceled, msg.Code_CANCELED},
+		{errors.New("some error"), msg.Code_INTERNAL},
+	} {
+		store.err = tt.err
+		for name, h := range handlers {
+			var rsp = h.handle(ctx, &nats.Msg{Data: marshal(t, h.req)})
+			if c := responseCode(rsp); c != tt.code {
+				t.Errorf("%s: %v: unexpected code %s", name, tt.err, c)
+			}
+		}
+	}
+
+	// health reports the error
+	store.err = driver.ErrBadConn
+	var rsp = qq.healthHandler(store)(ctx, &nats.Msg{}).(*msg.HealthResponse)
+	if rsp.DB != driver.ErrBadConn.Error() {
+		t.Error("wrong DB status:", rsp.DB)
+	}
+	store.err = nil
+	rsp = qq.healthHandler(store)(ctx, &nats.Msg{}).(*msg.HealthResponse)
+	if rsp.DB != "ok" {
+		t.Error("wrong DB status:", rsp.DB)
+	}
+
+}
+
+func TestQQ_serve_store(t *testing.T) {
+	// the store gets context of the request
+
+	var (
+		ms, _ = testMemStore(t)
+		qq    = new(QQ)
+		h     = handler{
+			subject: "test",
+			handle:  qq.handler(ms),
+			failure: itemFailure,
+		}
+	)
+
+	// expired request is not handled, an expired context is
+	// passed to the store otherwise
+	var req = &nats.Msg{
+		Data:   marshal(t, &msg.ID{ID: 1}),
+		Header: nats.Header{msg.TimeoutHeader: []string{"1"}},
+	}
+	var ctx, cancel = qq.requestContext(context.Background(), requestDeadline(req))
+	defer cancel()
+	<-ctx.Ctx.Done()
+	if c := responseCode(h.handle(ctx, req)); c != msg.Code_DEADLINE_EXCEEDED {
+		t.Error("unexpected code:", c)
+	}
+
+}
+
+func TestOpenStore(t *testing.T) {
+	// OpenStore(conf *Config, stop <-chan os.Signal) (store Store,
+	//     cs []prometheus.Collector, signaled bool, err error)
+
+	var (
+		conf = testConf
+		stop = make(chan os.Signal, 1)
+	)
+
+	conf.Backend = BackendMemory
+	store, cs, signaled, err := OpenStore(&conf, stop)
+	if err != nil || signaled || len(cs) != 0 {
+		t.Fatal("unexpected result:", err, signaled, cs)
+	}
+	if _, ok := store.(*MemStore); !ok {
+		t.Errorf("wrong store: %T", store)
+	}
+	store.Close()
+
+	// unreachable database, no retry
+	conf.Backend = BackendCockroachDB
+	conf.DBPort, conf.DBRetryWait = 1, 0
+	if store, _, signaled, err = OpenStore(&conf, stop); err == nil ||
+		signaled || store != nil {
+		t.Error("unexpected result:", err, signaled, store)
+	}
+
+	// waiting for the database is stopped by a signal
+	conf.DBRetryWait = 10 * time.Millisecond
+	stop <- os.Interrupt
+	if store, _, signaled, err = OpenStore(&conf, stop); !signaled ||
+		store != nil {
+		t.Error("unexpected result:", err, signaled, store)
+	}
+
+}
@@ -0,0 +1,206 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+// Package tracing represents OpenTelemetry settings shared by the
+// storage and the queryClient, and propagation of a trace context
+// through NATS message headers.
+package tracing
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exporters
+const (
+	ExporterNone   = ""       // no tracing
+	ExporterStdout = "stdout" // print spans to stdout
+	ExporterOTLP   = "otlp"   // send spans to OTLP/HTTP collector
+)
+
+// defaults
+const (
+	Exporter     = ExporterNone
+	OTLPEndpoint = "http://localhost:4318" // local collector
+	SampleRatio  = 1.0                     // trace all requests
+)
+
+// A Config represents tracing settings.
+type Config struct {
+	Exporter     string  // none, stdout or otlp
+	OTLPEndpoint string  // OTLP/HTTP collector URL
+	SampleRatio  float64 // ratio of traced requests, [0; 1]
+}
+
+// NewConfig with defaults.
+func NewConfig() (c *Config) {
+	c = new(Config)
+	c.Exporter = Exporter
+	c.OTLPEndpoint = OTLPEndpoint
+	c.SampleRatio = SampleRatio
+	return
+}
+
+// FromFlags obtains config values from command-line flags.
+// The prefix argument used to prefix all the flags with the
+// given prefix.
+func (c *Config) FromFlags(fset *flag.FlagSet, prefix string) {
+	fset.StringVar(&c.Exporter,
+		prefix+"trace-exporter",
+		c.Exporter,
+		"traces exporter: stdout or otlp, empty for no tracing")
+	fset.StringVar(&c.OTLPEndpoint,
+		prefix+"trace-otlp-endpoint",
+		c.OTLPEndpoint,
+		"OTLP/HTTP collector URL, http:// for insecure connection")
+	fset.Float64Var(&c.SampleRatio,
+		prefix+"trace-sample-ratio",
+		c.SampleRatio,
+		"ratio of traced requests, from 0 to 1")
+}
+
+// propagator of trace context, it's used even if tracing is disabled,
+// thus a service passes trace context of a request through
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Validate the Config.
+func (c *Config) Validate() error {
+	switch c.Exporter {
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+	default:
+		return fmt.Errorf("unknown trace exporter: %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("invalid trace sample ratio: %g", c.SampleRatio)
+	}
+	return nil
+}
+
+// Setup global tracer provider of given service. The returned
+// shutdown flushes pending spans, call it on exit.
+func (c *Config) Setup(service string) (
+	shutdown func(context.Context) error,
+	err error,
+) {
+	otel.SetTextMapPropagator(propagator)
+	if err = c.Validate(); err != nil {
+		return
+	}
+	var exp sdktrace.SpanExporter
+	switch c.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(c.OTLPEndpoint))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating trace exporter: %v", err)
+	}
+	var res *resource.Resource
+	res, err = resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", service),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating trace resource: %v", err)
+	}
+	var tp = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(c.SampleRatio),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// headerCarrier adapts NATS message headers to the propagator
+type headerCarrier nats.Header
+
+// Get value of the key.
+func (h headerCarrier) Get(key string) string {
+	return nats.Header(h).Get(key)
+}
+
+// Set value of the key.
+func (h headerCarrier) Set(key, val string) {
+	nats.Header(h).Set(key, val)
+}
+
+// Keys of the headers.
+func (h headerCarrier) Keys() (keys []string) {
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return
+}
+
+// Inject trace context of the ctx to headers of the NATS message.
+func Inject(ctx context.Context, m *nats.Msg) {
+	if m.Header == nil {
+		m.Header = nats.Header{}
+	}
+	propagator.Inject(ctx, headerCarrier(m.Header))
+}
+
+// Extract trace context from headers of the NATS message to the ctx.
+func Extract(ctx context.Context, m *nats.Msg) context.Context {
+	return propagator.Extract(ctx, headerCarrier(m.Header))
+}
+
+// ExtractHTTP returns context of the HTTP request with trace context
+// from the request headers, if any.
+func ExtractHTTP(r *http.Request) context.Context {
+	return propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// End the span recording given error, if any.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
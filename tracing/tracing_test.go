@@ -0,0 +1,195 @@
+//
+// Copyright (c) 2019 Konstantin Ivanov <kostyarin.ivanov@gmail.com>.
+// All rights reserved. This program is free software. It comes without
+// any warranty, to the extent permitted by applicable law. You can
+// redistribute it and/or modify it under the terms of the Do What
+// The Fuck You Want To Public License, Version 2, as published by
+// Sam Hocevar. See LICENSE file for more details or see below.
+//
+
+//
+//        DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//                    Version 2, December 2004
+//
+// Copyright (C) 2004 Sam Hocevar <sam@hocevar.net>
+//
+// Everyone is permitted to copy and distribute verbatim or modified
+// copies of this license document, and changing it is allowed as long
+// as the name is changed.
+//
+//            DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE
+//   TERMS AND CONDITIONS FOR COPYING, DISTRIBUTION AND MODIFICATION
+//
+//  0. You just DO WHAT THE FUCK YOU WANT TO.
+//
+
+package tracing
+
+import (
+	"context"
+	"flag"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewConfig(t *testing.T) {
+	// NewConfig() (c *Config)
+
+	conf := NewConfig()
+	isDefault := (conf.Exporter == Exporter) &&
+		(conf.OTLPEndpoint == OTLPEndpoint) &&
+		(conf.SampleRatio == SampleRatio)
+
+	if !isDefault {
+		t.Error("NewConfig contains non-default values")
+	}
+
+}
+
+func TestConfig_FromFlags(t *testing.T) {
+	// FromFlags(fset *flag.FlagSet, prefix string)
+
+	var fset = flag.NewFlagSet("test-set", flag.ContinueOnError)
+	var conf = NewConfig()
+
+	conf.FromFlags(fset, "x-")
+	err := fset.Parse([]string{
+		"-x-trace-exporter", "otlp",
+		"-x-trace-otlp-endpoint", "http://collector:4318",
+		"-x-trace-sample-ratio", "0.5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *conf != (Config{"otlp", "http://collector:4318", 0.5}) {
+		t.Errorf("incorrect arguments parsing: %+v", conf)
+	}
+
+}
+
+func TestConfig_Validate(t *testing.T) {
+	// Validate() error
+
+	if err := NewConfig().Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, conf := range []Config{
+		{"jaeger", OTLPEndpoint, 1},
+		{ExporterOTLP, OTLPEndpoint, 1.5},
+		{ExporterOTLP, OTLPEndpoint, -1},
+	} {
+		if err := conf.Validate(); err == nil {
+			t.Errorf("missing error: %+v", conf)
+		}
+	}
+
+}
+
+func TestConfig_Setup(t *testing.T) {
+	// Setup(service string) (shutdown func(context.Context) error,
+	//     err error)
+
+	for _, conf := range []Config{
+		{ExporterNone, OTLPEndpoint, 1},
+		{ExporterStdout, OTLPEndpoint, 1},
+		{ExporterOTLP, OTLPEndpoint, 0.5},
+	} {
+		shutdown, err := conf.Setup("test")
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", conf.Exporter, err)
+			continue
+		}
+		if err = shutdown(context.Background()); err != nil {
+			t.Errorf("%q: shutdown error: %v", conf.Exporter, err)
+		}
+	}
+
+	for _, conf := range []Config{
+		{"jaeger", OTLPEndpoint, 1},
+		{ExporterStdout, OTLPEndpoint, 1.5},
+		{ExporterStdout, OTLPEndpoint, -1},
+	} {
+		if _, err := conf.Setup("test"); err == nil {
+			t.Errorf("missing error: %+v", conf)
+		}
+	}
+
+}
+
+func TestInject(t *testing.T) {
+	// Inject(ctx context.Context, m *nats.Msg)
+	// Extract(ctx context.Context, m *nats.Msg) context.Context
+
+	var (
+		tp        = sdktrace.NewTracerProvider()
+		ctx, span = tp.Tracer("test").Start(context.Background(), "test")
+		m         = &nats.Msg{Subject: "test"}
+	)
+	defer span.End()
+
+	Inject(ctx, m)
+	if m.Header.Get("traceparent") == "" {
+		t.Fatal("missing traceparent header")
+	}
+
+	var sc = trace.SpanContextFromContext(Extract(context.Background(), m))
+	if !sc.IsRemote() || sc.TraceID() != span.SpanContext().TraceID() ||
+		sc.SpanID() != span.SpanContext().SpanID() {
+		t.Error("wrong extracted span context:", sc)
+	}
+
+	// no headers
+	sc = trace.SpanContextFromContext(Extract(context.Background(),
+		&nats.Msg{}))
+	if sc.IsValid() {
+		t.Error("unexpected span context:", sc)
+	}
+
+}
+
+func TestExtractHTTP(t *testing.T) {
+	// ExtractHTTP(r *http.Request) context.Context
+
+	var r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("traceparent",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	var sc = trace.SpanContextFromContext(ExtractHTTP(r))
+	if sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error("wrong trace ID:", sc.TraceID())
+	}
+
+}
+
+func TestEnd(t *testing.T) {
+	// End(span trace.Span, err error)
+
+	var (
+		rec = tracetest.NewSpanRecorder()
+		tp  = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	)
+	var _, ok = tp.Tracer("test").Start(context.Background(), "ok")
+	End(ok, nil)
+	var _, fail = tp.Tracer("test").Start(context.Background(), "fail")
+	End(fail, context.DeadlineExceeded)
+
+	var spans = rec.Ended()
+	if len(spans) != 2 {
+		t.Fatal("wrong number of ended spans:", len(spans))
+	}
+	if st := spans[0].Status(); st.Code != codes.Unset {
+		t.Error("wrong status:", st)
+	}
+	if st := spans[1].Status(); st.Code != codes.Error ||
+		st.Description != context.DeadlineExceeded.Error() {
+		t.Error("wrong status:", st)
+	}
+
+}